@@ -2,6 +2,8 @@
 
 import (
 	"context"
+	"fmt"
+	"github.com/spf13/pflag"
 	"os"
 	"os/signal"
 	"syscall"
@@ -20,5 +22,28 @@ func main() {
 		<-stop
 	}()
 
-	_ = backup.NewApp().Run(ctx)
+	app := backup.NewApp()
+
+	// 子命令, 不带子命令时启动代理服务
+	var err error
+	args := pflag.Args()
+	switch {
+	case len(args) == 0:
+		err = app.Run(ctx)
+	case args[0] == "replay":
+		err = app.Replay(ctx, args[1:])
+	case args[0] == "fixture":
+		err = app.Fixture(ctx, args[1:])
+	case args[0] == "dlq":
+		err = app.DLQ(ctx, args[1:])
+	case args[0] == "migrate":
+		err = app.Migrate(ctx, args[1:])
+	default:
+		err = fmt.Errorf("未知命令: %s", args[0])
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
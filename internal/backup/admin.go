@@ -0,0 +1,78 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+	"net"
+	"net/http"
+	"wechat-backup/internal/pkg/lifecycle"
+)
+
+// 管理接口的地址
+const (
+	healthzPath   = "/healthz"
+	poolStatsPath = "/stats/pool"
+	ruleStatsPath = "/stats/rules"
+)
+
+// newAdminHandler 管理接口: 健康检查、文章处理协程池和规则执行的统计
+func (s *backupServer) newAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(healthzPath, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(poolStatsPath, func(w http.ResponseWriter, r *http.Request) {
+		if s.pool == nil {
+			http.Error(w, "文章处理协程池未启动", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.pool.Stats())
+	})
+	mux.HandleFunc(ruleStatsPath, func(w http.ResponseWriter, r *http.Request) {
+		if s.manager == nil {
+			http.Error(w, "代理未启动", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.manager.Stats())
+	})
+	return mux
+}
+
+// adminHook 启动管理接口, 最先关闭. 未配置端口时不启动
+func (s *backupServer) adminHook() lifecycle.Hook {
+	var srv *http.Server
+	return lifecycle.Hook{
+		Name: "管理接口",
+		Start: func(context.Context) error {
+			if s.cfg.ServerRunOptions.AdminBindPort == 0 {
+				return nil
+			}
+
+			addr := fmt.Sprintf("%s:%d", s.cfg.ServerRunOptions.AdminBindAddress, s.cfg.ServerRunOptions.AdminBindPort)
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return fmt.Errorf("管理接口监听 %s 失败: %v", addr, err)
+			}
+
+			srv = &http.Server{Handler: s.newAdminHandler()}
+			go func() {
+				log.Infof("管理接口启动于 %s", addr)
+				if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Errorf("管理接口异常退出: %v", err)
+				}
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			if srv == nil {
+				return nil
+			}
+			return srv.Shutdown(ctx)
+		},
+	}
+}
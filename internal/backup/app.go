@@ -3,12 +3,16 @@ package backup
 import (
 	"context"
 	"github.com/fatih/color"
+	"github.com/marmotedu/errors"
 	"github.com/marmotedu/log"
 	"github.com/spf13/viper"
 	"os"
 	"wechat-backup/internal/backup/config"
 	"wechat-backup/internal/backup/options"
+	"wechat-backup/internal/backup/rules"
 	pkgconfig "wechat-backup/internal/pkg/config"
+	"wechat-backup/internal/pkg/mongo"
+	"wechat-backup/internal/repository"
 )
 
 var progressMessage = color.GreenString("==>")
@@ -23,27 +27,108 @@ func NewApp() *backupApp {
 
 func (a *backupApp) Run(ctx context.Context) error {
 	printWorkingDir()
-	err := pkgconfig.Init(BASENAME)
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	return Run(ctx, cfg)
+}
+
+// DLQ 管理重试后仍保存失败的文章, args 为 list [数量] | retry [ID...] | purge
+func (a *backupApp) DLQ(ctx context.Context, args []string) error {
+	cfg, err := loadConfig(ctx)
 	if err != nil {
 		return err
 	}
 
+	if err := initMongo(cfg.MongoOptions); err != nil {
+		return err
+	}
+	defer mongo.GetMongoDB().Close()
+
+	return DeadLetters(ctx, rules.NewMongoStore(repository.New(mongo.GetMongoDB())), args, os.Stdout)
+}
+
+// Migrate 执行数据库迁移, args 为 up | status
+func (a *backupApp) Migrate(ctx context.Context, args []string) error {
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := initMongo(cfg.MongoOptions); err != nil {
+		return err
+	}
+	defer mongo.GetMongoDB().Close()
+
+	runner, err := newMigrator()
+	if err != nil {
+		return err
+	}
+	return Migrations(ctx, runner, args, os.Stdout)
+}
+
+// loadConfig 读取配置文件
+func loadConfig(ctx context.Context) (*config.Config, error) {
+	err := pkgconfig.Init(BASENAME)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := options.NewOptions()
 
 	// Unmarshal the configuration data read from the file into the 'opts' variable.
 	if err := viper.Unmarshal(opts); err != nil {
-		return err
+		return nil, err
+	}
+	if errs := opts.Validate(); len(errs) > 0 {
+		return nil, errors.Wrap(errors.NewAggregate(errs), "配置错误")
 	}
 
 	log.Infof("%v Starting %s ...", progressMessage, BASENAME)
 	log.Infof("%v Config File Used: `%s`", progressMessage, viper.ConfigFileUsed())
 
-	cfg, err := config.CreateConfigFromOptions(ctx, opts)
+	return config.CreateConfigFromOptions(ctx, opts)
+}
+
+// Replay 离线回放 HAR 录制的流量, args 为 <har文件|目录> [响应体输出目录]
+func (a *backupApp) Replay(ctx context.Context, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("用法: " + BASENAME + " replay <har文件|目录> [响应体输出目录]")
+	}
+
+	outDir := ""
+	if len(args) == 2 {
+		outDir = args[1]
+	}
+
+	log.Infof("%v Replaying %s ...", progressMessage, args[0])
+	_, err := Replay(ctx, args[0], outDir, os.Stdout)
+	return err
+}
+
+// Fixture 将抓取到的页面转换为解析器样本, args 为 <名称> <页面文件|HAR文件> [请求地址]
+func (a *backupApp) Fixture(ctx context.Context, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("用法: " + BASENAME + " fixture <名称> <页面文件|HAR文件> [请求地址]")
+	}
+
+	link := ""
+	if len(args) == 3 {
+		link = args[2]
+	}
+
+	files, err := MakeFixture(FixtureDir, args[0], args[1], link)
 	if err != nil {
 		return err
 	}
 
-	return Run(ctx, cfg)
+	for _, f := range files {
+		log.Infof("%v 已写入样本: %s", progressMessage, f)
+	}
+	log.Infof("%v 请检查脱敏结果, 然后运行 go test ./internal/backup/rules -run TestGolden -update 生成期望输出", progressMessage)
+	return nil
 }
 
 func printWorkingDir() {
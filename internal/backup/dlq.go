@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"strconv"
+	"wechat-backup/internal/backup/rules"
+)
+
+const dlqUsage = "用法: " + BASENAME + " dlq list [数量] | retry [ID...] | purge"
+
+// DeadLetters 执行 dlq 子命令:
+//
+//	list [数量]   按时间顺序列出死信
+//	retry [ID...] 重新保存死信中的文章, 成功后删除, 不指定 ID 时重试全部
+//	purge         清空死信
+func DeadLetters(ctx context.Context, store rules.Store, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(dlqUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		limit := 0
+		if len(args) > 2 {
+			return errors.New(dlqUsage)
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return errors.Errorf("数量格式错误: %s", args[1])
+			}
+			limit = n
+		}
+		return listDeadLetters(ctx, store, limit, out)
+
+	case "retry":
+		var ids []primitive.ObjectID
+		for _, arg := range args[1:] {
+			id, err := primitive.ObjectIDFromHex(arg)
+			if err != nil {
+				return errors.Errorf("ID格式错误: %s", arg)
+			}
+			ids = append(ids, id)
+		}
+
+		n, err := rules.RetryDeadLetters(ctx, store, ids)
+		_, _ = fmt.Fprintf(out, "%v 重新保存 %d 篇文章\n", progressMessage, n)
+		return err
+
+	case "purge":
+		if len(args) != 1 {
+			return errors.New(dlqUsage)
+		}
+		n, err := store.PurgeDeadLetters(ctx)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(out, "%v 删除 %d 条死信\n", progressMessage, n)
+		return nil
+
+	default:
+		return errors.New(dlqUsage)
+	}
+}
+
+func listDeadLetters(ctx context.Context, store rules.Store, limit int, out io.Writer) error {
+	list, err := store.ListDeadLetters(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	for _, dl := range list {
+		_, _ = fmt.Fprintf(out, "%v %s %s 尝试 %d 次\n", progressMessage, dl.ID.Hex(), dl.CreatedAt.Format("2006-01-02 15:04:05"), dl.Attempts)
+		if dl.Post != nil {
+			_, _ = fmt.Fprintf(out, "    文章: %s\n", dl.Post.Title)
+			_, _ = fmt.Fprintf(out, "    链接: %s\n", dl.Post.Link)
+		}
+		_, _ = fmt.Fprintf(out, "    错误: %s\n", truncate(dl.Error, 300))
+	}
+	_, _ = fmt.Fprintf(out, "\n共 %d 条死信\n", len(list))
+	return nil
+}
@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"wechat-backup/internal/backup/rules"
+	"wechat-backup/internal/model"
+)
+
+func TestDeadLetters(t *testing.T) {
+	store := rules.NewMemoryStore()
+	require.NoError(t, store.SaveDeadLetter(context.Background(), &model.Post{MsgBiz: "biz", MsgMid: "1", MsgIdx: "1", Title: "第一篇"}, errors.New("timeout"), 6))
+	require.NoError(t, store.SaveDeadLetter(context.Background(), &model.Post{MsgBiz: "biz", MsgMid: "2", MsgIdx: "1", Title: "第二篇"}, errors.New("timeout"), 6))
+	require.NoError(t, store.SaveDeadLetter(context.Background(), &model.Post{Title: "缺少标识"}, errors.New("invalid"), 1))
+	dead, _ := store.ListDeadLetters(context.Background(), 0)
+
+	var out bytes.Buffer
+	require.NoError(t, DeadLetters(context.Background(), store, []string{"list", "2"}, &out))
+	assert.Contains(t, out.String(), dead[0].ID.Hex())
+	assert.Contains(t, out.String(), "第二篇")
+	assert.NotContains(t, out.String(), "缺少标识")
+	assert.Contains(t, out.String(), "共 2 条死信")
+
+	// 指定 ID 重试
+	out.Reset()
+	require.NoError(t, DeadLetters(context.Background(), store, []string{"retry", dead[0].ID.Hex()}, &out))
+	assert.Contains(t, out.String(), "重新保存 1 篇文章")
+	assert.Len(t, store.Posts(), 1)
+
+	// 重试全部, 仍然失败的死信保留
+	out.Reset()
+	err := DeadLetters(context.Background(), store, []string{"retry"}, &out)
+	assert.ErrorContains(t, err, dead[2].ID.Hex())
+	assert.Contains(t, out.String(), "重新保存 1 篇文章")
+	assert.Len(t, store.Posts(), 2)
+	remaining, _ := store.ListDeadLetters(context.Background(), 0)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, dead[2].ID, remaining[0].ID)
+
+	out.Reset()
+	require.NoError(t, DeadLetters(context.Background(), store, []string{"purge"}, &out))
+	assert.Contains(t, out.String(), "删除 1 条死信")
+	remaining, _ = store.ListDeadLetters(context.Background(), 0)
+	assert.Empty(t, remaining)
+
+	assert.Error(t, DeadLetters(context.Background(), store, []string{"retry", "not-an-id"}, &out))
+	assert.Error(t, DeadLetters(context.Background(), store, []string{"unknown"}, &out))
+	assert.Error(t, DeadLetters(context.Background(), store, nil, &out))
+}
@@ -0,0 +1,159 @@
+// Package fakewechat 提供一个进程内的 mp.weixin.qq.com 假服务, 用于端到端测试.
+// 页面内容来自规则测试的脱敏样本 internal/backup/rules/testdata/golden, 两处测试使用同一份样本.
+package fakewechat
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// 样本中的公众号和文章标识
+const (
+	Biz = "MzA5MDAwMDAwMQ=="
+
+	MidNormal    = "2650000001"
+	MidDeleted   = "2650000002"
+	MidViolation = "2650000003"
+
+	ShortLinkID = "AbCdEfGhIjKlMnOpQrStUv"
+
+	// 旧版图文消息 /mp/appmsg/show 的 appmsgid
+	AppMsgIDLegacy = "10000006"
+)
+
+var shortLinkPath = regexp.MustCompile(`^/s/[\w-]{22}$`)
+
+// Server 假的微信公众号服务
+type Server struct {
+	*httptest.Server
+
+	dir      string
+	mtx      sync.Mutex
+	requests []string
+}
+
+// New 启动一个 TLS 假服务, 样本从 dir 目录读取
+func New(dir string) *Server {
+	s := &Server{dir: dir}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// DialContext 将所有连接重定向到假服务, 用于替换代理的 Transport.DialContext
+func (s *Server) DialContext(ctx context.Context, network, _ string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, network, s.Listener.Addr().String())
+}
+
+// Requests 返回收到的请求, 格式为 "METHOD /path?query"
+func (s *Server) Requests() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	s.mtx.Unlock()
+
+	query := r.URL.Query()
+
+	switch {
+	case r.URL.Path == "/mp/profile_ext" && query.Get("action") == "home":
+		s.fixture(w, r, "profile_home.html", "text/html; charset=utf-8")
+	case r.URL.Path == "/mp/profile_ext" && query.Get("action") == "getmsg":
+		s.fixture(w, r, "getmsg.json", "application/json; charset=UTF-8")
+	case r.URL.Path == "/mp/getappmsgext" && r.Method == http.MethodPost:
+		s.fixture(w, r, "getappmsgext.json", "application/json; charset=UTF-8")
+	case r.URL.Path == "/s":
+		switch query.Get("mid") {
+		case MidNormal:
+			s.fixture(w, r, "article.html", "text/html; charset=utf-8")
+		case MidDeleted:
+			s.fixture(w, r, "article_deleted.html", "text/html; charset=utf-8")
+		case MidViolation:
+			s.fixture(w, r, "article_violation.html", "text/html; charset=utf-8")
+		default:
+			http.NotFound(w, r)
+		}
+	case r.URL.Path == "/mp/appmsg/show" && query.Get("appmsgid") == AppMsgIDLegacy:
+		s.fixture(w, r, "article_appmsg_show.html", "text/html; charset=utf-8")
+	case shortLinkPath.MatchString(r.URL.Path):
+		s.fixture(w, r, "article_short_link.html", "text/html; charset=utf-8")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fixture 返回样本, 和真实服务一样按 Accept-Encoding 压缩
+func (s *Server) fixture(w http.ResponseWriter, r *http.Request, name string, contentType string) {
+	data, err := s.Fixture(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	encoding, data, err := compress(data, r.Header.Get("Accept-Encoding"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	_, _ = w.Write(data)
+}
+
+// compress 按 br、gzip、deflate 的顺序选择客户端支持的压缩方式
+func compress(data []byte, acceptEncoding string) (string, []byte, error) {
+	accepted := make(map[string]bool)
+	for _, enc := range strings.Split(acceptEncoding, ",") {
+		accepted[strings.TrimSpace(strings.SplitN(enc, ";", 2)[0])] = true
+	}
+
+	var (
+		buf      bytes.Buffer
+		w        io.WriteCloser
+		encoding string
+	)
+	switch {
+	case accepted["br"]:
+		encoding, w = "br", brotli.NewWriter(&buf)
+	case accepted["gzip"]:
+		encoding, w = "gzip", gzip.NewWriter(&buf)
+	case accepted["deflate"]:
+		encoding, w = "deflate", zlib.NewWriter(&buf)
+	default:
+		return "", data, nil
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return "", nil, err
+	}
+	if err := w.Close(); err != nil {
+		return "", nil, err
+	}
+	return encoding, buf.Bytes(), nil
+}
+
+// Fixture 返回样本内容
+func (s *Server) Fixture(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, name))
+}
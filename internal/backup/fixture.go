@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"wechat-backup/internal/backup/rules"
+	"wechat-backup/internal/pkg/har"
+	pkgoptions "wechat-backup/internal/pkg/options"
+)
+
+// FixtureDir 解析器 golden 测试的样本目录, 相对于仓库根目录
+const FixtureDir = "internal/backup/rules/testdata/golden"
+
+var fixtureName = regexp.MustCompile(`^[\w.-]+$`)
+
+// MakeFixture 将抓取到的页面脱敏后保存为解析器样本, 返回写入的文件.
+// src 为页面文件时必须提供 link; src 为 HAR 文件时取第一条命中规则的记录,
+// link 不为空时只考虑 URL 以 link 开头的记录.
+// 脱敏使用 HAR 录制的默认规则, 保存后仍需人工检查页面中的昵称、头像等信息.
+func MakeFixture(dir, name, src, link string) ([]string, error) {
+	if !fixtureName.MatchString(name) {
+		return nil, fmt.Errorf("样本名称只能包含字母、数字、下划线、点和横线: %s", name)
+	}
+
+	var (
+		body []byte
+		err  error
+	)
+	if strings.HasSuffix(src, ".har") {
+		link, body, err = fixtureFromHAR(src, link)
+	} else {
+		body, err = fixtureFromPage(src, link)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	harOpts := pkgoptions.NewHarOptions()
+	redactor, err := har.NewRedactor(harOpts.RedactParams, harOpts.RedactHeaders, harOpts.RedactBody)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := ".html"
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		ext = ".json"
+	}
+
+	files := map[string][]byte{
+		filepath.Join(dir, name+ext):    []byte(redactor.Text(string(body))),
+		filepath.Join(dir, name+".url"): []byte(redactor.URL(link) + "\n"),
+	}
+	for path := range files {
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("样本已存在: %s", path)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建样本目录失败: %v", err)
+	}
+
+	var written []string
+	for _, path := range []string{filepath.Join(dir, name+ext), filepath.Join(dir, name+".url")} {
+		if err := os.WriteFile(path, files[path], 0o644); err != nil {
+			return written, fmt.Errorf("写入样本失败: %v", err)
+		}
+		written = append(written, path)
+	}
+
+	return written, nil
+}
+
+// fixtureFromPage 读取页面文件, 并检查 link 是否命中规则
+func fixtureFromPage(src, link string) ([]byte, error) {
+	if link == "" {
+		return nil, fmt.Errorf("页面文件需要提供请求地址")
+	}
+
+	body, err := os.ReadFile(src)
+	if err != nil {
+		return nil, fmt.Errorf("读取页面失败: %v", err)
+	}
+
+	manager := rules.NewManager(rules.NewMemoryStore(), nil, nil)
+	if len(manager.Matched(&rules.Context{URL: link, Method: "GET"})) == 0 {
+		return nil, fmt.Errorf("请求地址未命中任何规则: %s", link)
+	}
+
+	return body, nil
+}
+
+// fixtureFromHAR 从 HAR 文件中取第一条命中规则的 GET 记录
+func fixtureFromHAR(src, link string) (string, []byte, error) {
+	entries, err := har.LoadPath(src)
+	if err != nil {
+		return "", nil, err
+	}
+
+	manager := rules.NewManager(rules.NewMemoryStore(), nil, nil)
+	for i := range entries {
+		if link != "" && !strings.HasPrefix(entries[i].Request.URL, link) {
+			continue
+		}
+
+		ruleCtx, err := replayContext(&entries[i])
+		if err != nil {
+			return "", nil, fmt.Errorf("第 %d 条记录解析失败: %v", i, err)
+		}
+		if ruleCtx.Method != "GET" || len(manager.Matched(ruleCtx)) == 0 {
+			continue
+		}
+
+		return ruleCtx.URL, ruleCtx.Body, nil
+	}
+
+	return "", nil, fmt.Errorf("HAR 文件中没有命中规则的记录: %s", src)
+}
@@ -0,0 +1,36 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeFixture(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "captured.html")
+	require.NoError(t, os.WriteFile(src, []byte(`<script>var link = "/mp/getappmsgext?uin=123&key=secret";</script>`), 0o644))
+
+	out := filepath.Join(dir, "golden")
+	link := "https://mp.weixin.qq.com/s?__biz=MzA5&mid=1&idx=1&key=secret"
+	files, err := MakeFixture(out, "article_new", src, link)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(out, "article_new.html"), filepath.Join(out, "article_new.url")}, files)
+
+	body, _ := os.ReadFile(files[0])
+	assert.NotContains(t, string(body), "secret")
+	assert.NotContains(t, string(body), "123")
+	u, _ := os.ReadFile(files[1])
+	assert.Equal(t, "https://mp.weixin.qq.com/s?__biz=MzA5&idx=1&key=REDACTED&mid=1\n", string(u))
+
+	// 不覆盖已有样本
+	_, err = MakeFixture(out, "article_new", src, link)
+	assert.Error(t, err)
+
+	// 未命中规则的地址
+	_, err = MakeFixture(out, "other", src, "https://mp.weixin.qq.com/mp/unrelated")
+	assert.Error(t, err)
+}
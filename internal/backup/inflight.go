@@ -0,0 +1,65 @@
+package backup
+
+import (
+	"context"
+	"github.com/marmotedu/errors"
+	"sync"
+)
+
+// inflight 记录正在执行规则的请求. 开始关闭后新的请求不再执行规则,
+// 已经开始的规则执行完, 解析出的文章交给协程池之后才关闭协程池
+type inflight struct {
+	mtx      sync.Mutex
+	draining bool
+	n        int
+	idle     chan struct{}
+}
+
+// enter 开始执行规则, 正在关闭时返回 false
+func (f *inflight) enter() bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.draining {
+		return false
+	}
+	f.n++
+	return true
+}
+
+// leave 规则执行完成
+func (f *inflight) leave() {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.n--
+	if f.n == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// drain 停止接收新的请求, 等待正在执行的规则完成
+func (f *inflight) drain(ctx context.Context) error {
+	f.mtx.Lock()
+	f.draining = true
+	if f.n == 0 {
+		f.mtx.Unlock()
+		return nil
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle := f.idle
+	f.mtx.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		f.mtx.Lock()
+		n := f.n
+		f.mtx.Unlock()
+		return errors.Wrapf(ctx.Err(), "仍有 %d 个请求在执行规则", n)
+	}
+}
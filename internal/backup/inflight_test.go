@@ -0,0 +1,38 @@
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflightDrain(t *testing.T) {
+	var f inflight
+	require.True(t, f.enter())
+	require.True(t, f.enter())
+
+	// 超时时报告仍在执行的请求数
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := f.drain(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "仍有 2 个请求")
+
+	// 开始关闭后新的请求不再执行规则
+	assert.False(t, f.enter())
+
+	done := make(chan error, 1)
+	go func() { done <- f.drain(context.Background()) }()
+	f.leave()
+	f.leave()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("请求完成后 drain 没有返回")
+	}
+}
@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"github.com/marmotedu/errors"
+	"io"
+	"wechat-backup/internal/backup/migrations"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/migrate"
+	"wechat-backup/internal/pkg/mongo"
+)
+
+const migrateUsage = "用法: " + BASENAME + " migrate up | status"
+
+// newMigrator 创建迁移执行器, 已执行的迁移记录在 schema_migrations 集合中
+func newMigrator() (*migrate.Runner, error) {
+	history := migrate.NewMongoHistory(mongo.GetMongoDB().Collection(model.CollectionMigrations))
+	return migrate.New(history, migrations.All()...)
+}
+
+// Migrations 执行 migrate 子命令:
+//
+//	up     按顺序执行尚未执行的迁移
+//	status 列出全部迁移及执行时间
+func Migrations(ctx context.Context, runner *migrate.Runner, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := runner.Up(ctx)
+		for _, m := range done {
+			_, _ = fmt.Fprintf(out, "%v 已执行迁移 %d: %s\n", progressMessage, m.Version, m.Description)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			_, _ = fmt.Fprintf(out, "%v 没有需要执行的迁移\n", progressMessage)
+		}
+		return nil
+
+	case "status":
+		states, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			appliedAt := "未执行"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			_, _ = fmt.Fprintf(out, "%v %d %s %s\n", progressMessage, s.Version, appliedAt, s.Description)
+		}
+		return nil
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
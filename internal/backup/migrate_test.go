@@ -0,0 +1,55 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"wechat-backup/internal/pkg/migrate"
+)
+
+type memoryHistory []migrate.Record
+
+func (h *memoryHistory) Applied(context.Context) ([]migrate.Record, error) {
+	return *h, nil
+}
+
+func (h *memoryHistory) Add(_ context.Context, record migrate.Record) error {
+	*h = append(*h, record)
+	return nil
+}
+
+func TestMigrations(t *testing.T) {
+	ran := 0
+	runner, err := migrate.New(&memoryHistory{}, migrate.Migration{
+		Version:     1,
+		Description: "统一字段名",
+		Up: func(context.Context) error {
+			ran++
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, Migrations(context.Background(), runner, []string{"status"}, &out))
+	assert.Contains(t, out.String(), "1 未执行 统一字段名")
+
+	out.Reset()
+	require.NoError(t, Migrations(context.Background(), runner, []string{"up"}, &out))
+	assert.Contains(t, out.String(), "已执行迁移 1: 统一字段名")
+
+	out.Reset()
+	require.NoError(t, Migrations(context.Background(), runner, []string{"up"}, &out))
+	assert.Contains(t, out.String(), "没有需要执行的迁移")
+	assert.Equal(t, 1, ran)
+
+	out.Reset()
+	require.NoError(t, Migrations(context.Background(), runner, []string{"status"}, &out))
+	assert.NotContains(t, out.String(), "未执行")
+
+	assert.Error(t, Migrations(context.Background(), runner, nil, &out))
+	assert.Error(t, Migrations(context.Background(), runner, []string{"down"}, &out))
+}
@@ -0,0 +1,196 @@
+// Package migrations 数据库迁移, 新的迁移追加到 All 的末尾, 已发布的迁移不要修改
+package migrations
+
+import (
+	"context"
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/migrate"
+	"wechat-backup/internal/pkg/mongo"
+	"wechat-backup/internal/pkg/wxlink"
+)
+
+// All 按版本号排列的全部迁移
+func All() []migrate.Migration {
+	return []migrate.Migration{
+		{Version: 1, Description: "统一字段名为驼峰命名", Up: normalizeFieldNames},
+		{Version: 2, Description: "文章链接改为规范链接, 去掉链接和页面中的会话参数", Up: canonicalizeLinks},
+	}
+}
+
+// 旧版本使用的字段名
+const (
+	legacyCreatedAt   = "created_at"
+	legacyUpdatedAt   = "updated_at"
+	legacyWechatID    = "wechat_id"
+	legacyProfileID   = "profile_id"
+	legacyContentType = "content_type"
+	legacySendTime    = "send_time"
+	legacyMessageID   = "message_id"
+)
+
+// MongoDB 的错误码
+const (
+	codeNamespaceNotFound = 26
+	codeIndexNotFound     = 27
+)
+
+// normalizeFieldNames 旧版本的模型使用 created_at/updated_at, 规则使用 createdAt/updatedAt,
+// 同一个文档中可能两种字段都有. 合并为 createdAt/updatedAt: 创建时间优先使用驼峰字段, 更新时间取较新的一个.
+// 消息和媒体文件的下划线字段改名, 公众号的 wechat_id 在 username 为空时移到 username
+func normalizeFieldNames(ctx context.Context) error {
+	db := mongo.GetMongoDB()
+
+	timestamps := bson.A{
+		bson.M{"$set": bson.M{
+			model.FieldCreatedAt: bson.M{"$ifNull": bson.A{"$" + model.FieldCreatedAt, bson.M{"$ifNull": bson.A{"$" + legacyCreatedAt, "$$REMOVE"}}}},
+			model.FieldUpdatedAt: bson.M{"$ifNull": bson.A{bson.M{"$max": bson.A{"$" + model.FieldUpdatedAt, "$" + legacyUpdatedAt}}, "$$REMOVE"}},
+		}},
+		bson.M{"$unset": bson.A{legacyCreatedAt, legacyUpdatedAt}},
+	}
+	legacyTimestamps := bson.M{"$or": bson.A{
+		bson.M{legacyCreatedAt: bson.M{"$exists": true}},
+		bson.M{legacyUpdatedAt: bson.M{"$exists": true}},
+	}}
+	for _, name := range []string{model.CollectionProfiles, model.CollectionPosts, model.CollectionMessages, model.CollectionMedia, model.CollectionDeadLetters} {
+		if err := updateMany(ctx, db.Collection(name), legacyTimestamps, timestamps); err != nil {
+			return err
+		}
+	}
+
+	renames := map[string]bson.M{
+		model.CollectionMessages: {legacyProfileID: model.FieldProfileID, legacyContentType: model.FieldContentType, legacySendTime: model.FieldSendTime},
+		model.CollectionMedia:    {legacyMessageID: model.FieldMessageID},
+	}
+	for name, fields := range renames {
+		var exists bson.A
+		for old := range fields {
+			exists = append(exists, bson.M{old: bson.M{"$exists": true}})
+		}
+		if err := updateMany(ctx, db.Collection(name), bson.M{"$or": exists}, bson.M{"$rename": fields}); err != nil {
+			return err
+		}
+	}
+
+	username := bson.A{
+		bson.M{"$set": bson.M{
+			model.FieldUsername: bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$" + model.FieldUsername, ""}}, ""}},
+				"$" + model.FieldUsername,
+				"$" + legacyWechatID,
+			}},
+		}},
+		bson.M{"$unset": legacyWechatID},
+	}
+	if err := updateMany(ctx, db.Collection(model.CollectionProfiles), bson.M{legacyWechatID: bson.M{"$exists": true}}, username); err != nil {
+		return err
+	}
+
+	// 死信按 createdAt 排序, 新索引在启动时创建
+	_, err := db.Collection(model.CollectionDeadLetters).Indexes().DropOne(ctx, legacyCreatedAt)
+	var cmdErr driver.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Code == codeIndexNotFound || cmdErr.Code == codeNamespaceNotFound)) {
+		return errors.Wrapf(err, "删除索引 %s.%s 失败", model.CollectionDeadLetters, legacyCreatedAt)
+	}
+	return nil
+}
+
+// canonicalizeLinks 文章和死信中的链接带有 key、pass_ticket 等会话参数, 改为只包含文章标识的规范链接,
+// 页面 HTML 中的会话参数替换为 REDACTED. 旧文章的原始链接不保留, 其中的会话参数早已过期
+func canonicalizeLinks(ctx context.Context) error {
+	db := mongo.GetMongoDB()
+
+	if err := rewriteLinks(ctx, db.Collection(model.CollectionPosts), ""); err != nil {
+		return err
+	}
+	return rewriteLinks(ctx, db.Collection(model.CollectionDeadLetters), model.FieldPost+".")
+}
+
+// linkBatchSize 每次 BulkWrite 更新的文档数
+const linkBatchSize = 500
+
+// rewriteLinks 将集合中 prefix 下的 link 改为规范链接, html 中的会话参数脱敏, 没有变化的文档不更新
+func rewriteLinks(ctx context.Context, collection *driver.Collection, prefix string) error {
+	fields := map[string]func(string) string{
+		prefix + model.FieldLink: wxlink.Canonical,
+		prefix + model.FieldHTML: wxlink.Redact,
+	}
+	projection := bson.M{}
+	var filter bson.A
+	for field := range fields {
+		projection[field] = 1
+		filter = append(filter, bson.M{field: bson.M{"$type": "string"}})
+	}
+
+	opts := options.Find().SetProjection(projection)
+	cursor, err := collection.Find(ctx, bson.M{"$or": filter}, opts)
+	if err != nil {
+		return errors.Wrapf(err, "读取集合 %s 失败", collection.Name())
+	}
+	defer cursor.Close(ctx)
+
+	var models []driver.WriteModel
+	var modified int64
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		result, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return errors.Wrapf(err, "更新集合 %s 失败", collection.Name())
+		}
+		modified += result.ModifiedCount
+		models = models[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		set := bson.M{}
+		for field, rewrite := range fields {
+			value, ok := cursor.Current.Lookup(strings.Split(field, ".")...).StringValueOK()
+			if !ok {
+				continue
+			}
+			if rewritten := rewrite(value); rewritten != value {
+				set[field] = rewritten
+			}
+		}
+		if len(set) > 0 {
+			models = append(models, driver.NewUpdateOneModel().
+				SetFilter(bson.M{model.FieldID: cursor.Current.Lookup(model.FieldID)}).
+				SetUpdate(bson.M{"$set": set}))
+		}
+		if len(models) >= linkBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return errors.Wrapf(err, "读取集合 %s 失败", collection.Name())
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if modified > 0 {
+		log.Infof("集合 %s: 更新 %d 个文档", collection.Name(), modified)
+	}
+	return nil
+}
+
+func updateMany(ctx context.Context, collection *driver.Collection, filter, update interface{}) error {
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return errors.Wrapf(err, "更新集合 %s 失败", collection.Name())
+	}
+	if result.ModifiedCount > 0 {
+		log.Infof("集合 %s: 更新 %d 个文档", collection.Name(), result.ModifiedCount)
+	}
+	return nil
+}
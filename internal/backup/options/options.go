@@ -18,6 +18,27 @@ type Options struct {
 
 	// Redis 配置选项
 	RedisOptions *pkgoptions.RedisOptions `json:"redis" mapstructure:"redis"`
+
+	// 代理客户端访问控制配置选项
+	ProxyAuthOptions *pkgoptions.ProxyAuthOptions `json:"auth" mapstructure:"auth"`
+
+	// MITM 拦截范围配置选项
+	MitmOptions *pkgoptions.MitmOptions `json:"mitm" mapstructure:"mitm"`
+
+	// HAR 录制配置选项
+	HarOptions *pkgoptions.HarOptions `json:"har" mapstructure:"har"`
+
+	// MITM 证书缓存配置选项
+	CertCacheOptions *pkgoptions.CertCacheOptions `json:"cert-cache" mapstructure:"cert-cache"`
+
+	// 声明式抓取规则配置选项
+	CaptureOptions *pkgoptions.CaptureOptions `json:"capture" mapstructure:"capture"`
+
+	// 文章处理队列配置选项
+	QueueOptions *pkgoptions.QueueOptions `json:"queue" mapstructure:"queue"`
+
+	// 文章链接配置选项
+	LinkOptions *pkgoptions.LinkOptions `json:"link" mapstructure:"link"`
 }
 
 // NewOptions 创建一个带有默认值的 Options
@@ -27,6 +48,13 @@ func NewOptions() *Options {
 		Log:              log.NewOptions(),
 		MongoOptions:     pkgoptions.NewMongoOptions(),
 		RedisOptions:     pkgoptions.NewRedisOptions(),
+		ProxyAuthOptions: pkgoptions.NewProxyAuthOptions(),
+		MitmOptions:      pkgoptions.NewMitmOptions(),
+		HarOptions:       pkgoptions.NewHarOptions(),
+		CertCacheOptions: pkgoptions.NewCertCacheOptions(),
+		CaptureOptions:   pkgoptions.NewCaptureOptions(),
+		QueueOptions:     pkgoptions.NewQueueOptions(),
+		LinkOptions:      pkgoptions.NewLinkOptions(),
 	}
 }
 
@@ -46,6 +74,27 @@ func (o *Options) Validate() []error {
 	// 验证 Redis 选项
 	errs = append(errs, o.RedisOptions.Validate()...)
 
+	// 验证代理访问控制选项
+	errs = append(errs, o.ProxyAuthOptions.Validate()...)
+
+	// 验证 MITM 选项
+	errs = append(errs, o.MitmOptions.Validate()...)
+
+	// 验证 HAR 录制选项
+	errs = append(errs, o.HarOptions.Validate()...)
+
+	// 验证证书缓存选项
+	errs = append(errs, o.CertCacheOptions.Validate()...)
+
+	// 验证声明式抓取规则
+	errs = append(errs, o.CaptureOptions.Validate()...)
+
+	// 验证文章处理队列选项
+	errs = append(errs, o.QueueOptions.Validate()...)
+
+	// 验证文章链接选项
+	errs = append(errs, o.LinkOptions.Validate()...)
+
 	return errs
 }
 
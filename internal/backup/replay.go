@@ -0,0 +1,163 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/marmotedu/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"wechat-backup/internal/backup/rules"
+	"wechat-backup/internal/pkg/har"
+)
+
+// ReplayResult 单条记录的回放结果
+type ReplayResult struct {
+	Index    int                `json:"index"`
+	Method   string             `json:"method"`
+	URL      string             `json:"url"`
+	Rules    []rules.RuleType   `json:"rules"`
+	Error    string             `json:"error,omitempty"`
+	Writes   []rules.StoreWrite `json:"writes,omitempty"`
+	Rewrote  bool               `json:"rewrote"`
+	BodyFile string             `json:"bodyFile,omitempty"`
+}
+
+// Replay 将 HAR 文件或目录中的记录交给规则处理, 不启动代理也不连接数据库.
+// 写入操作记录在内存存储中, outDir 不为空时改写后的响应体会保存到该目录.
+func Replay(ctx context.Context, path string, outDir string, out io.Writer) ([]ReplayResult, error) {
+	entries, err := har.LoadPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建输出目录失败: %v", err)
+		}
+	}
+
+	store := rules.NewMemoryStore()
+	manager := rules.NewManager(store, nil, nil)
+
+	var results []ReplayResult
+	for i, entry := range entries {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		ruleCtx, err := replayContext(&entry)
+		if err != nil {
+			return results, fmt.Errorf("第 %d 条记录解析失败: %v", i, err)
+		}
+
+		matched := manager.Matched(ruleCtx)
+		if len(matched) == 0 {
+			continue
+		}
+
+		result := ReplayResult{Index: i, Method: ruleCtx.Method, URL: ruleCtx.URL}
+		for _, rule := range matched {
+			result.Rules = append(result.Rules, rule.Type())
+		}
+
+		// 与代理一致: 先执行请求阶段, 规则直接应答时不再执行响应阶段
+		original := string(ruleCtx.Body)
+		var errs []error
+		if err := manager.HandleRequest(ruleCtx); err != nil {
+			errs = append(errs, err)
+		}
+		if !ruleCtx.Reply {
+			if err := manager.HandleResponse(ruleCtx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := errors.NewAggregate(errs); err != nil {
+			result.Error = err.Error()
+		}
+		result.Writes = store.TakeWrites()
+		result.Rewrote = string(ruleCtx.Body) != original
+
+		if result.Rewrote && outDir != "" {
+			result.BodyFile = filepath.Join(outDir, fmt.Sprintf("%04d.body", i))
+			if err := os.WriteFile(result.BodyFile, ruleCtx.Body, 0o644); err != nil {
+				return results, fmt.Errorf("保存响应体失败: %v", err)
+			}
+		}
+
+		results = append(results, result)
+		printReplayResult(out, &result)
+	}
+
+	_, _ = fmt.Fprintf(out, "\n共 %d 条记录, 命中规则 %d 条, 公众号 %d 个, 文章 %d 篇\n",
+		len(entries), len(results), len(store.Profiles()), len(store.Posts()))
+
+	return results, nil
+}
+
+// replayContext 将 HAR 条目转换为规则上下文
+func replayContext(entry *har.Entry) (*rules.Context, error) {
+	body, err := entry.ResponseBody()
+	if err != nil {
+		return nil, err
+	}
+	requestBody, err := entry.RequestBody()
+	if err != nil {
+		return nil, err
+	}
+
+	ruleCtx := &rules.Context{
+		URL:         entry.Request.URL,
+		Method:      entry.Request.Method,
+		Headers:     make(map[string]string),
+		Body:        body,
+		RequestBody: requestBody,
+		Client:      "replay",
+		ContentType: entry.Response.Content.MimeType,
+	}
+	for _, h := range entry.Request.Headers {
+		if _, ok := ruleCtx.Headers[h.Name]; !ok {
+			ruleCtx.Headers[h.Name] = h.Value
+		}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime); err == nil {
+		ruleCtx.StartedAt = t
+	}
+
+	return ruleCtx, nil
+}
+
+func printReplayResult(out io.Writer, result *ReplayResult) {
+	var ruleNames []string
+	for _, t := range result.Rules {
+		ruleNames = append(ruleNames, string(t))
+	}
+
+	_, _ = fmt.Fprintf(out, "%v #%d %s %s\n", progressMessage, result.Index, result.Method, result.URL)
+	_, _ = fmt.Fprintf(out, "    命中规则: %s\n", strings.Join(ruleNames, ", "))
+	if result.Error != "" {
+		_, _ = fmt.Fprintf(out, "    处理失败: %s\n", result.Error)
+	}
+	for _, w := range result.Writes {
+		data, _ := json.Marshal(w.Data)
+		_, _ = fmt.Fprintf(out, "    写入 %s: %s\n", w.Op, truncate(string(data), 300))
+	}
+	if result.Rewrote {
+		if result.BodyFile != "" {
+			_, _ = fmt.Fprintf(out, "    响应已改写: %s\n", result.BodyFile)
+		} else {
+			_, _ = fmt.Fprintln(out, "    响应已改写")
+		}
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"wechat-backup/internal/backup/rules"
+	"wechat-backup/internal/pkg/har"
+)
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	msgList, _ := json.Marshal(map[string]interface{}{
+		"list": []interface{}{
+			map[string]interface{}{
+				"comm_msg_info": map[string]interface{}{"datetime": 1700000000},
+				"app_msg_ext_info": map[string]interface{}{
+					"title":       "标题",
+					"content_url": "http://mp.weixin.qq.com/s?__biz=MzA5&amp;mid=100&amp;idx=1&amp;sn=abc",
+				},
+			},
+		},
+	})
+	body, _ := json.Marshal(map[string]string{"general_msg_list": string(msgList)})
+
+	rec, err := har.NewRecorder(dir, 0, 0, nil)
+	require.NoError(t, err)
+	for _, link := range []string{
+		"https://mp.weixin.qq.com/mp/profile_ext?action=getmsg&__biz=MzA5&offset=10",
+		"https://mp.weixin.qq.com/mp/unrelated",
+	} {
+		req := httptest.NewRequest(http.MethodGet, link, nil)
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(nil)),
+		}
+		require.NoError(t, rec.Record(har.NewEntry(time.Now(), req, nil, resp, body)))
+	}
+	require.NoError(t, rec.Close())
+
+	var out bytes.Buffer
+	results, err := Replay(context.Background(), dir, "", &out)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	result := results[0]
+	assert.Equal(t, []rules.RuleType{rules.RuleTypeList}, result.Rules)
+	assert.Empty(t, result.Error)
+	require.Len(t, result.Writes, 1)
+	assert.Equal(t, "SavePosts", result.Writes[0].Op)
+	assert.Contains(t, out.String(), "共 2 条记录, 命中规则 1 条")
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.har"))
+	assert.Len(t, files, 1)
+}
@@ -5,102 +5,39 @@ import (
 	"fmt"
 	"github.com/marmotedu/errors"
 	"github.com/marmotedu/log"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/url"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
 	"wechat-backup/internal/model"
-	"wechat-backup/internal/pkg/mongo"
 	"wechat-backup/internal/pkg/util/html"
+	"wechat-backup/internal/pkg/wxlink"
 )
 
-// 全局协程池配置
-var (
-	// 最大并发处理的文章数
-	maxConcurrentArticles = 10
-	// 文章处理通道
-	articleChan = make(chan *model.Post, 100)
-	// 等待组，用于优雅退出
-	articleWg sync.WaitGroup
-	// 初始化标志
-	poolInitialized = false
-	// 互斥锁，用于初始化保护
-	poolMutex sync.Mutex
-)
-
-// initArticleProcessPool 初始化文章处理协程池
-func initArticleProcessPool() {
-	poolMutex.Lock()
-	defer poolMutex.Unlock()
-
-	if poolInitialized {
-		return
-	}
-
-	// 启动工作协程
-	for i := 0; i < maxConcurrentArticles; i++ {
-		articleWg.Add(1)
-		go func(workerID int) {
-			defer articleWg.Done()
-			for post := range articleChan {
-				// 处理文章保存
-				err := savePostDetail(post)
-				if err != nil {
-					log.Errorf("工作协程 #%d 保存文章失败: %v", workerID, err)
-				}
-			}
-		}(i)
-	}
-
-	poolInitialized = true
-	log.Infof("文章处理协程池已初始化，工作协程数: %d", maxConcurrentArticles)
-}
-
-// ShutdownArticleProcessPool 关闭协程池，等待所有任务完成
-func ShutdownArticleProcessPool() {
-	poolMutex.Lock()
-	defer poolMutex.Unlock()
-
-	if !poolInitialized {
-		return
-	}
-
-	// 关闭通道，停止接收新任务
-	close(articleChan)
-
-	// 等待所有任务完成
-	done := make(chan struct{})
-	go func() {
-		articleWg.Wait()
-		close(done)
-	}()
-
-	// 设置超时，防止永久阻塞
-	select {
-	case <-done:
-		log.Info("所有文章处理任务已完成")
-	case <-time.After(30 * time.Second):
-		log.Warn("等待文章处理任务超时，可能有任务未完成")
-	}
-
-	poolInitialized = false
-}
+// deadLetterTimeout 直接保存失败后写入死信的超时时间
+const deadLetterTimeout = 5 * time.Second
 
 // ContentRule 文章内容规则
 type ContentRule struct {
 	BaseRule
+	pool *ArticlePool
+	// 加密原始链接, 为空时不保存原始链接
+	sealer *wxlink.Sealer
 }
 
-func NewContentRule() *ContentRule {
+// NewContentRule 创建文章内容规则, 文章交给 pool 异步保存, pool 为空时同步保存.
+// 文章只保存规范链接, sealer 不为空时加密保存原始链接
+func NewContentRule(store Store, pool *ArticlePool, sealer *wxlink.Sealer) *ContentRule {
 	return &ContentRule{
-		BaseRule{
+		BaseRule: BaseRule{
 			ruleType: RuleTypeContent,
 			// 匹配三种文章URL格式
 			urlPattern: "mp.weixin.qq.com/s",
+			store:      store,
+			priority:   PriorityContent,
 		},
+		pool:   pool,
+		sealer: sealer,
 	}
 }
 
@@ -109,19 +46,14 @@ func (r *ContentRule) Match(ctx *Context) bool {
 	// 匹配三种URL格式，支持可选的:443端口
 	isPost := strings.Contains(link, "mp.weixin.qq.com") && strings.Contains(link, "/s?__biz")
 	isOldPost := strings.Contains(link, "mp.weixin.qq.com") && strings.Contains(link, "/mp/appmsg/show")
-	isShortLink := regexp.MustCompile(`mp\.weixin\.qq\.com(:\d+)?\/s\/(\w|-){22}`).MatchString(link)
+	isShortLink := shortLinkPattern.MatchString(link)
 	return isPost || isOldPost || isShortLink
 }
 
-func (r *ContentRule) Handle(ctx *Context) error {
-	// 确保协程池已初始化
-	if !poolInitialized {
-		initArticleProcessPool()
-	}
-
+func (r *ContentRule) HandleResponse(ctx *Context) (Result, error) {
 	// 只处理GET请求
 	if ctx.Method != "GET" {
-		return nil
+		return Continue, nil
 	}
 
 	content := string(ctx.Body)
@@ -132,26 +64,48 @@ func (r *ContentRule) Handle(ctx *Context) error {
 		strings.Contains(content, "此内容因违规无法查看") ||
 		strings.Contains(content, "此内容被投诉且经审核涉嫌侵权") ||
 		strings.Contains(content, "此内容已被发布者删除") {
-		return handleInvalidPost(ctx.URL)
+		return Continue, handleInvalidPost(ctx.Context(), r.store, ctx.URL, ctx.Client)
 	}
 
-	// 解析文章信息
-	post, err := parsePostDetail(ctx.URL, content)
+	// 解析文章信息, 旧版图文消息页面使用单独的解析
+	parse := parsePostDetail
+	if isLegacyArticle(ctx.URL) {
+		parse = parseLegacyPostDetail
+	}
+	post, err := parse(ctx.URL, content)
 	if err != nil {
-		return err
+		return Continue, err
 	}
+	post.CapturedBy = ctx.Client
+	if id := shortLinkID(ctx.URL); id != "" {
+		resolveShortLink(ctx.Context(), r.store, id, post)
+	}
+	r.sealRawLink(post, ctx.URL)
 
 	log.Infof("=====> 文章内容提取到的信息:%+v", post)
 
 	// 将文章放入处理队列而不是直接保存
-	select {
-	case articleChan <- post:
+	switch err := r.pool.Submit(post); {
+	case err == nil:
 		log.Infof("文章 [%s] 已加入处理队列", post.Title)
+	case errors.Is(err, ErrArticleDropped):
+		log.Warnf("文章 [%s] 未保存: %v", post.Title, err)
+	case errors.Is(err, errPoolStopped):
+		// 协程池未启动，直接保存
+		if err := savePostDetail(ctx.Context(), r.store, post); err != nil {
+			return Continue, err
+		}
 	default:
-		// 如果队列已满，直接保存
-		log.Warnf("处理队列已满，直接保存文章 [%s]", post.Title)
-		if err = savePostDetail(post); err != nil {
-			return err
+		// 写入队列失败时直接保存一次, 不在代理协程中重试, 失败的文章转入死信
+		log.Warnf("文章 [%s] 加入处理队列失败，直接保存: %v", post.Title, err)
+		if err := savePostDetail(ctx.Context(), r.store, post); err != nil {
+			// 规则超时后上下文已取消, 死信单独限时写入, 文章不会丢失
+			dlCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx.Context()), deadLetterTimeout)
+			defer cancel()
+			if dlErr := r.store.SaveDeadLetter(dlCtx, post, err, 1); dlErr != nil {
+				return Continue, err
+			}
+			log.Errorf("保存文章 [%s] 失败, 转入死信: %v", post.Title, err)
 		}
 	}
 
@@ -160,20 +114,41 @@ func (r *ContentRule) Handle(ctx *Context) error {
 	content = strings.ReplaceAll(content, "</body>", script+"</body>")
 	ctx.Body = []byte(content)
 
-	return nil
+	return Continue, nil
+}
+
+// sealRawLink 原始链接与规范链接不同时加密保存, 加密失败只丢弃原始链接
+func (r *ContentRule) sealRawLink(post *model.Post, link string) {
+	if r.sealer == nil || link == post.Link {
+		return
+	}
+
+	sealed, err := r.sealer.Seal(link)
+	if err != nil {
+		log.Warnf("加密文章 [%s] 的原始链接失败: %v", post.Title, err)
+		return
+	}
+	post.RawLink = sealed
 }
 
 // parsePostDetail 解析文章详情
 func parsePostDetail(link string, content string) (*model.Post, error) {
 	// 解析URL参数
-	u, err := url.Parse(link)
+	msgBiz, msgMid, msgIdx, err := linkPostKey(link)
 	if err != nil {
 		return nil, err
 	}
-	query := u.Query()
-	msgBiz := query.Get("__biz")
-	msgMid := query.Get("mid")
-	msgIdx := query.Get("idx")
+
+	// 短链接的地址中没有文章标识, 从页面变量中读取, 并使用页面中的规范链接
+	if msgBiz == "" || msgMid == "" || msgIdx == "" {
+		var canonical string
+		msgBiz, msgMid, msgIdx, canonical = parsePageKey(content)
+		if canonical != "" {
+			link = canonical
+		}
+	}
+	// 去掉与阅读者会话相关的参数, 日志中也不输出
+	link = wxlink.Canonical(link)
 
 	// 提取文章信息
 	var msgTitle string
@@ -304,7 +279,7 @@ func parsePostDetail(link string, content string) (*model.Post, error) {
 		Link:          link,
 		Digest:        msgDesc,
 		Content:       msgContentNonXSS,
-		HTML:          content,
+		HTML:          wxlink.Redact(content),
 		PublishAt:     time.Unix(publishTime, 0),
 		WechatId:      wechatId,
 		Username:      username,
@@ -356,39 +331,46 @@ func cleanContent(content string) string {
 	return strings.TrimSpace(content)
 }
 
-// handleInvalidPost 处理失效文章
-func handleInvalidPost(link string) error {
-	// 解析URL获取文章ID
+// linkPostKey 读取链接中的文章标识, 旧版链接使用 appmsgid 和 itemidx
+func linkPostKey(link string) (msgBiz, msgMid, msgIdx string, err error) {
 	u, err := url.Parse(link)
 	if err != nil {
-		return err
+		return "", "", "", err
 	}
 	query := u.Query()
-	msgBiz := query.Get("__biz")
-	msgMid := query.Get("mid")
-	msgIdx := query.Get("idx")
-
-	// 更新数据库标记文章失效
-	db := mongo.GetMongoDB()
-	collection := db.Collection("posts")
+	msgBiz = query.Get("__biz")
+	msgMid = firstNonEmpty(query.Get("mid"), query.Get("appmsgid"))
+	msgIdx = firstNonEmpty(query.Get("idx"), query.Get("itemidx"))
+	return msgBiz, msgMid, msgIdx, nil
+}
 
-	filter := bson.M{
-		"msgBiz": msgBiz,
-		"msgMid": msgMid,
-		"msgIdx": msgIdx,
+// handleInvalidPost 处理失效文章
+func handleInvalidPost(ctx context.Context, store Store, link string, client string) error {
+	// 解析URL获取文章ID
+	msgBiz, msgMid, msgIdx, err := linkPostKey(link)
+	if err != nil {
+		return err
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"isFail":    true,
-			"updatedAt": time.Now(),
-		},
+	// 短链接使用已记录的映射
+	if id := shortLinkID(link); id != "" && msgBiz == "" {
+		sl, err := store.FindShortLink(ctx, id)
+		if err != nil {
+			return err
+		}
+		if sl != nil {
+			msgBiz, msgMid, msgIdx = sl.MsgBiz, sl.MsgMid, sl.MsgIdx
+		}
+	}
+	link = wxlink.Canonical(link)
+	if msgBiz == "" || msgMid == "" || msgIdx == "" {
+		log.Warnf("[文章已失效] 无法确定文章标识, 跳过: %s", wxlink.Redact(link))
+		return nil
 	}
 
-	opts := options.Update().SetUpsert(true)
-	_, err = collection.UpdateOne(context.Background(), filter, update, opts)
-	if err != nil {
-		return errors.Wrap(err, "更新失效文章状态失败")
+	// 更新数据库标记文章失效
+	if err = store.MarkPostInvalid(ctx, msgBiz, msgMid, msgIdx, client); err != nil {
+		return err
 	}
 
 	log.Infof("[文章已失效] link: %s", link)
@@ -427,74 +409,13 @@ func parsePublishTime(s string) int64 {
 }
 
 // savePostDetail 保存文章详情
-func savePostDetail(post *model.Post) error {
+func savePostDetail(ctx context.Context, store Store, post *model.Post) error {
 	// 检查必要字段
 	if post.MsgBiz == "" || post.MsgMid == "" || post.MsgIdx == "" {
 		return errors.New("文章缺少必要字段 (MsgBiz, MsgMid, MsgIdx)")
 	}
 
-	// 获取数据库连接
-	db := mongo.GetMongoDB()
-	collection := db.Collection("posts")
-
-	// 构建查询条件
-	filter := bson.M{
-		"msgBiz": post.MsgBiz,
-		"msgMid": post.MsgMid,
-		"msgIdx": post.MsgIdx,
-	}
-
-	// 检查文章是否已存在
-	var existingPost model.Post
-	err := collection.FindOne(context.Background(), filter).Decode(&existingPost)
-	if err == nil {
-		// 文章已存在，更新阅读数和点赞数
-		update := bson.M{
-			"$set": bson.M{
-				"updatedAt": time.Now(),
-				"readNum":   post.ReadNum,
-				"likeNum":   post.LikeNum,
-			},
-		}
-
-		// 如果原文章内容为空但现在有了，也进行更新
-		if existingPost.Content == "" && post.Content != "" {
-			update["$set"].(bson.M)["content"] = post.Content
-			update["$set"].(bson.M)["html"] = post.HTML
-		}
-
-		// 如果之前的标题为空但现在有了，也进行更新
-		if existingPost.Title == "" && post.Title != "" {
-			update["$set"].(bson.M)["title"] = post.Title
-		}
-
-		// 如果之前的作者为空但现在有了，也进行更新
-		if existingPost.Author == "" && post.Author != "" {
-			update["$set"].(bson.M)["author"] = post.Author
-		}
-
-		_, err = collection.UpdateOne(context.Background(), filter, update)
-		if err != nil {
-			return errors.Wrapf(err, "更新文章失败")
-		}
-
-		log.Infof("更新文章 %s 成功", post.Title)
-		return nil
-	}
-
-	// 设置创建和更新时间
-	now := time.Now()
-	post.CreatedAt = now
-	post.UpdatedAt = now
-
-	// 如果是新文章，插入数据库
-	_, err = collection.InsertOne(context.Background(), post)
-	if err != nil {
-		return errors.Wrapf(err, "保存文章失败")
-	}
-
-	log.Infof("保存新文章 %s 成功", post.Title)
-	return nil
+	return store.SavePostDetail(ctx, post)
 }
 
 // getAutoJumpScript 获取自动跳转脚本
@@ -0,0 +1,315 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/queue"
+	"wechat-backup/internal/pkg/wxlink"
+)
+
+func TestArticleProcessPool(t *testing.T) {
+	link, err := os.ReadFile(filepath.Join(goldenDir, "article.url"))
+	require.NoError(t, err)
+	body, err := os.ReadFile(filepath.Join(goldenDir, "article.html"))
+	require.NoError(t, err)
+
+	store := NewMemoryStore()
+	pool := NewArticlePool(store, queue.NewMemory(10), PoolConfig{Workers: 2})
+	require.NoError(t, pool.Start())
+
+	ctx := &Context{URL: strings.TrimSpace(string(link)), Method: "GET", Body: body, Client: "phone1"}
+	_, err = NewContentRule(store, pool, nil).HandleResponse(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, string(ctx.Body), "/wx/posts/next_link")
+
+	// 关闭时处理完队列中的文章, 经过队列的文章与同步保存的一致
+	require.NoError(t, pool.Shutdown(context.Background()))
+
+	posts := store.Posts()
+	require.Len(t, posts, 1)
+	assert.Equal(t, "phone1", posts[0].CapturedBy)
+	assert.NotEmpty(t, posts[0].Title)
+	assert.NotEmpty(t, posts[0].Content)
+
+	// 协程池关闭后同步保存
+	_, err = NewContentRule(store, pool, nil).HandleResponse(ctx)
+	require.NoError(t, err)
+	assert.Len(t, store.Posts(), 1)
+}
+
+// flakyStore 前 failures 次保存文章返回 err
+type flakyStore struct {
+	*MemoryStore
+	mtx      sync.Mutex
+	failures int
+	err      error
+	calls    int
+}
+
+func (s *flakyStore) SavePostDetail(ctx context.Context, post *model.Post) error {
+	s.mtx.Lock()
+	s.calls++
+	fail := s.calls <= s.failures
+	s.mtx.Unlock()
+
+	if fail {
+		return s.err
+	}
+	return s.MemoryStore.SavePostDetail(ctx, post)
+}
+
+var transientErr = driver.CommandError{Code: 91, Message: "shutdown in progress", Labels: []string{"RetryableWriteError"}}
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 3 * time.Millisecond}
+	assert.Equal(t, time.Millisecond, p.Backoff(1))
+	assert.Equal(t, 2*time.Millisecond, p.Backoff(2))
+	assert.Equal(t, 3*time.Millisecond, p.Backoff(3))
+	assert.Equal(t, 3*time.Millisecond, p.Backoff(10))
+
+	// 临时错误重试到成功
+	calls := 0
+	attempts, err := p.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return transientErr
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// 超过重试次数
+	attempts, err = p.Do(context.Background(), func() error { return transientErr })
+	assert.Error(t, err)
+	assert.Equal(t, 4, attempts)
+
+	// 其它错误不重试
+	attempts, err = p.Do(context.Background(), func() error { return errors.New("duplicate key") })
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(transientErr))
+	assert.True(t, IsTransient(context.DeadlineExceeded))
+	assert.True(t, IsTransient(driver.CommandError{Labels: []string{"NetworkError"}}))
+	assert.False(t, IsTransient(driver.CommandError{Code: 11000, Message: "duplicate key"}))
+	assert.False(t, IsTransient(errors.New("文章缺少必要字段")))
+	assert.False(t, IsTransient(nil))
+}
+
+func TestArticleProcessPoolDeadLetter(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		posts     int
+		attempts  int
+		deadCount int
+	}{
+		{"transient error recovers", 2, transientErr, 1, 0, 0},
+		{"transient error exhausts retries", 3, transientErr, 0, 3, 1},
+		{"permanent error", 1, errors.New("document too large"), 0, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &flakyStore{MemoryStore: NewMemoryStore(), failures: tt.failures, err: tt.err}
+			pool := NewArticlePool(store, queue.NewMemory(10), PoolConfig{
+				Workers: 1,
+				Retry:   RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			})
+			require.NoError(t, pool.Start())
+
+			require.NoError(t, pool.Submit(&model.Post{MsgBiz: "biz", MsgMid: "1", MsgIdx: "1", Title: "标题"}))
+			require.Eventually(t, func() bool {
+				dead, _ := store.ListDeadLetters(context.Background(), 0)
+				return len(store.Posts())+len(dead) > 0
+			}, time.Second, time.Millisecond)
+			require.NoError(t, pool.Shutdown(context.Background()))
+
+			assert.Len(t, store.Posts(), tt.posts)
+			dead, err := store.ListDeadLetters(context.Background(), 0)
+			require.NoError(t, err)
+			require.Len(t, dead, tt.deadCount)
+			if tt.deadCount > 0 {
+				assert.Equal(t, "标题", dead[0].Post.Title)
+				assert.Equal(t, tt.attempts, dead[0].Attempts)
+				assert.Equal(t, tt.err.Error(), dead[0].Error)
+
+				// 重新处理死信
+				n, err := RetryDeadLetters(context.Background(), store, nil)
+				require.NoError(t, err)
+				assert.Equal(t, 1, n)
+				assert.Len(t, store.Posts(), 1)
+				dead, _ = store.ListDeadLetters(context.Background(), 0)
+				assert.Empty(t, dead)
+			}
+		})
+	}
+}
+
+func TestArticleProcessPoolShutdownInterruptsRetry(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), failures: 100, err: transientErr}
+	pool := NewArticlePool(store, queue.NewMemory(10), PoolConfig{
+		Workers: 1,
+		Retry:   RetryPolicy{MaxRetries: 100, InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+	})
+	require.NoError(t, pool.Start())
+
+	require.NoError(t, pool.Submit(&model.Post{MsgBiz: "biz", MsgMid: "1", MsgIdx: "1", Title: "标题"}))
+	require.Eventually(t, func() bool {
+		store.mtx.Lock()
+		defer store.mtx.Unlock()
+		return store.calls > 0
+	}, time.Second, time.Millisecond)
+
+	// 关闭时不等待退避, 文章转入死信
+	start := time.Now()
+	require.NoError(t, pool.Shutdown(context.Background()))
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	dead, err := store.ListDeadLetters(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 1, dead[0].Attempts)
+}
+
+func TestContentRuleTimeoutCancelsSave(t *testing.T) {
+	link, err := os.ReadFile(filepath.Join(goldenDir, "article.url"))
+	require.NoError(t, err)
+	body, err := os.ReadFile(filepath.Join(goldenDir, "article.html"))
+	require.NoError(t, err)
+
+	// 数据库卡住时, 规则超时后保存被取消, 规则随之结束
+	store := &gatedStore{MemoryStore: NewMemoryStore(), gate: make(chan struct{})}
+	defer close(store.gate)
+	rule := NewContentRule(store, nil, nil)
+	rule.timeout = 20 * time.Millisecond
+	m := &Manager{}
+	m.Register(rule)
+
+	// 保存被取消后规则可能先于超时判断返回, 此时不计为放弃, 两种情况规则都已结束
+	err = m.HandleResponse(&Context{URL: strings.TrimSpace(string(link)), Method: "GET", Body: body})
+	assert.Error(t, err)
+	assert.LessOrEqual(t, m.Stats().Abandoned, uint64(1))
+	require.Eventually(t, func() bool { return m.Stats().AbandonedRunning == 0 }, time.Second, time.Millisecond)
+	assert.Empty(t, store.Posts())
+}
+
+func TestContentRuleShortLink(t *testing.T) {
+	link, err := os.ReadFile(filepath.Join(goldenDir, "article_short_link.url"))
+	require.NoError(t, err)
+	body, err := os.ReadFile(filepath.Join(goldenDir, "article_short_link.html"))
+	require.NoError(t, err)
+	shortLink := strings.TrimSpace(string(link))
+
+	// 历史列表中已经保存的同一篇文章
+	store := NewMemoryStore()
+	_, err = store.SavePosts(context.Background(), []*model.Post{{MsgBiz: "MzA5MDAwMDAwMQ==", MsgMid: "2650000004", MsgIdx: "1", Title: "短链接测试文章", Cover: "cover.jpg"}})
+	require.NoError(t, err)
+
+	rule := NewContentRule(store, nil, nil)
+	require.True(t, rule.Match(&Context{URL: shortLink}))
+	_, err = rule.HandleResponse(&Context{URL: shortLink, Method: "GET", Body: body})
+	require.NoError(t, err)
+
+	// 按页面中的标识合并到已有文章, 链接使用规范链接
+	posts := store.Posts()
+	require.Len(t, posts, 1)
+	assert.Equal(t, "cover.jpg", posts[0].Cover)
+	assert.NotEmpty(t, posts[0].Content)
+	assert.Contains(t, posts[0].Link, "/s?__biz=MzA5MDAwMDAwMQ==&mid=2650000004&idx=1")
+
+	sl, err := store.FindShortLink(context.Background(), "AbCdEfGhIjKlMnOpQrStUv")
+	require.NoError(t, err)
+	require.NotNil(t, sl)
+	assert.Equal(t, "2650000004", sl.MsgMid)
+
+	// 文章删除后的页面没有标识, 使用记录的映射
+	deleted := []byte(`<div class="global_error_msg">此内容已被发布者删除</div>`)
+	_, err = rule.HandleResponse(&Context{URL: shortLink, Method: "GET", Body: deleted, Client: "phone1"})
+	require.NoError(t, err)
+	posts = store.Posts()
+	require.Len(t, posts, 1)
+	assert.True(t, posts[0].IsFail)
+
+	// 没有映射的短链接不会写入空标识的文章
+	_, err = rule.HandleResponse(&Context{URL: "https://mp.weixin.qq.com/s/ZZZZZZZZZZZZZZZZZZZZZZ", Method: "GET", Body: deleted})
+	require.NoError(t, err)
+	assert.Len(t, store.Posts(), 1)
+}
+
+func TestContentRuleRawLink(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join(goldenDir, "article.html"))
+	require.NoError(t, err)
+	link := "http://mp.weixin.qq.com:443/s?__biz=MzA5MDAwMDAwMQ==&mid=2650000001&idx=1&sn=0123456789abcdef0123456789abcdef" +
+		"&chksm=deadbeef&scene=27&key=k&pass_ticket=p&uin=u&devicetype=d&version=v#wechat_redirect"
+
+	sealer, err := wxlink.NewSealer(bytes.Repeat([]byte{1}, wxlink.KeySize))
+	require.NoError(t, err)
+	store := NewMemoryStore()
+	_, err = NewContentRule(store, nil, sealer).HandleResponse(&Context{URL: link, Method: "GET", Body: body})
+	require.NoError(t, err)
+
+	// 只保存规范链接, 原始链接加密保存
+	posts := store.Posts()
+	require.Len(t, posts, 1)
+	assert.Equal(t, "https://mp.weixin.qq.com/s?__biz=MzA5MDAwMDAwMQ==&mid=2650000001&idx=1&sn=0123456789abcdef0123456789abcdef", posts[0].Link)
+	assert.NotContains(t, posts[0].RawLink, "pass_ticket")
+	raw, err := sealer.Open(posts[0].RawLink)
+	require.NoError(t, err)
+	assert.Equal(t, link, raw)
+
+	// 没有密钥时不保存原始链接
+	store = NewMemoryStore()
+	_, err = NewContentRule(store, nil, nil).HandleResponse(&Context{URL: link, Method: "GET", Body: body})
+	require.NoError(t, err)
+	require.Len(t, store.Posts(), 1)
+	assert.Empty(t, store.Posts()[0].RawLink)
+}
+
+func TestContentRuleRedactsHTML(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join(goldenDir, "article.html"))
+	require.NoError(t, err)
+	// 真实页面的全局变量中带有阅读者的会话参数
+	session := `<script>var uin = "u1"; var key = "k1"; var pass_ticket = "p1"; window.appmsg_token = "t1";</script>`
+	body = append([]byte(session), body...)
+	link := "https://mp.weixin.qq.com/s?__biz=MzA5MDAwMDAwMQ==&mid=2650000001&idx=1&sn=0123456789abcdef0123456789abcdef&key=k1"
+
+	store := NewMemoryStore()
+	ctx := &Context{URL: link, Method: "GET", Body: body}
+	_, err = NewContentRule(store, nil, nil).HandleResponse(ctx)
+	require.NoError(t, err)
+
+	posts := store.Posts()
+	require.Len(t, posts, 1)
+	for _, v := range []string{"u1", "k1", "p1", "t1"} {
+		assert.NotContains(t, posts[0].HTML, `"`+v+`"`)
+	}
+	assert.Contains(t, posts[0].HTML, `var pass_ticket = "REDACTED"`)
+	// 返回给客户端的页面不变
+	assert.Contains(t, string(ctx.Body), `var pass_ticket = "p1"`)
+}
+
+func TestParsePageKey(t *testing.T) {
+	msgBiz, msgMid, msgIdx, link := parsePageKey(`var biz = "" || "MzA5";
+var mid = "" || "2650";
+var msg_link = "http://mp.weixin.qq.com/s?__biz=MzA5&amp;mid=2650&amp;idx=2&amp;sn=abc#rd";`)
+	assert.Equal(t, "MzA5", msgBiz)
+	assert.Equal(t, "2650", msgMid)
+	assert.Equal(t, "2", msgIdx)
+	assert.Equal(t, "http://mp.weixin.qq.com/s?__biz=MzA5&mid=2650&idx=2&sn=abc", link)
+}
@@ -0,0 +1,55 @@
+package rules
+
+import (
+	"context"
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"wechat-backup/internal/model"
+)
+
+// RetryDeadLetters 重新保存死信中的文章, 成功后删除死信. ids 为空时重试全部死信, 返回成功的数量.
+// 仍然失败的死信保留, 错误汇总后返回
+func RetryDeadLetters(ctx context.Context, store Store, ids []primitive.ObjectID) (int, error) {
+	// 指定 ID 时只读取这些死信, 死信中有完整的页面, 不要全部读出
+	var (
+		list []*model.DeadLetter
+		err  error
+	)
+	if len(ids) > 0 {
+		list, err = store.FindDeadLetters(ctx, ids)
+	} else {
+		list, err = store.ListDeadLetters(ctx, 0)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	wanted := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var (
+		succeeded int
+		errs      []error
+	)
+	for _, dl := range list {
+		delete(wanted, dl.ID)
+
+		if err := savePostDetail(ctx, store, dl.Post); err != nil {
+			errs = append(errs, errors.Errorf("死信 %s: %v", dl.ID.Hex(), err))
+			continue
+		}
+		if err := store.DeleteDeadLetter(ctx, dl.ID); err != nil {
+			errs = append(errs, errors.Errorf("死信 %s: %v", dl.ID.Hex(), err))
+			continue
+		}
+		succeeded++
+	}
+
+	for id := range wanted {
+		errs = append(errs, errors.Errorf("死信 %s 不存在", id.Hex()))
+	}
+
+	return succeeded, errors.NewAggregate(errs)
+}
@@ -0,0 +1,57 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"wechat-backup/internal/model"
+)
+
+// listCountingStore 记录读取全部死信的次数
+type listCountingStore struct {
+	*MemoryStore
+	lists int
+}
+
+func (s *listCountingStore) ListDeadLetters(ctx context.Context, limit int) ([]*model.DeadLetter, error) {
+	s.lists++
+	return s.MemoryStore.ListDeadLetters(ctx, limit)
+}
+
+func TestRetryDeadLettersByID(t *testing.T) {
+	ctx := context.Background()
+	store := &listCountingStore{MemoryStore: NewMemoryStore()}
+	for _, mid := range []string{"1", "2"} {
+		post := &model.Post{MsgBiz: "biz", MsgMid: mid, MsgIdx: "1", Title: "标题" + mid}
+		require.NoError(t, store.SaveDeadLetter(ctx, post, errors.New("超时"), 3))
+	}
+	dead, err := store.MemoryStore.ListDeadLetters(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, dead, 2)
+
+	// 指定 ID 时只读取对应的死信
+	missing := primitive.NewObjectID()
+	n, err := RetryDeadLetters(ctx, store, []primitive.ObjectID{dead[0].ID, missing})
+	assert.Equal(t, 1, n)
+	assert.ErrorContains(t, err, missing.Hex()+" 不存在")
+	assert.Zero(t, store.lists)
+
+	posts := store.Posts()
+	require.Len(t, posts, 1)
+	assert.Equal(t, "标题1", posts[0].Title)
+	left, err := store.MemoryStore.ListDeadLetters(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, left, 1)
+	assert.Equal(t, dead[1].ID, left[0].ID)
+
+	// 不指定 ID 时重试全部
+	n, err = RetryDeadLetters(ctx, store, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, store.lists)
+}
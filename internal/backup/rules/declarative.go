@@ -0,0 +1,340 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/options"
+	"wechat-backup/internal/pkg/util/hostmatch"
+)
+
+// DeclarativeRule 由配置声明的抓取规则, 不需要写代码就可以抓取新的接口.
+// 只在响应阶段执行, 提取出的每条记录按 upsert 键写入指定集合
+type DeclarativeRule struct {
+	BaseRule
+	spec   options.CaptureRule
+	host   *hostmatch.Matcher
+	isJSON bool
+
+	itemsPath gval.Evaluable
+	itemsCSS  cascadia.Selector
+	fields    []fieldExtractor
+}
+
+// fieldExtractor 预编译的字段提取规则
+type fieldExtractor struct {
+	options.CaptureField
+	jsonPath gval.Evaluable
+	css      cascadia.Selector
+	regex    *regexp.Regexp
+	required bool // 必填字段或 upsert 键
+}
+
+// NewDeclarativeRules 根据配置创建声明式规则
+func NewDeclarativeRules(specs []options.CaptureRule, store Store) ([]Rule, error) {
+	var list []Rule
+	for _, spec := range specs {
+		r, err := NewDeclarativeRule(spec, store)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+// NewDeclarativeRule 根据配置创建声明式规则, 预编译其中的 JSONPath、CSS 选择器和正则
+func NewDeclarativeRule(spec options.CaptureRule, store Store) (*DeclarativeRule, error) {
+	if errs := (&options.CaptureOptions{Rules: []options.CaptureRule{spec}}).Validate(); len(errs) > 0 {
+		return nil, errors.NewAggregate(errs)
+	}
+
+	r := &DeclarativeRule{
+		BaseRule: BaseRule{
+			ruleType: RuleType(spec.Name),
+			store:    store,
+			priority: spec.Priority,
+			timeout:  spec.Timeout,
+		},
+		spec:   spec,
+		isJSON: strings.EqualFold(spec.ContentType, "json"),
+	}
+	if spec.Host != "" {
+		r.host = hostmatch.New(spec.Host)
+	}
+
+	var err error
+	if spec.Items != "" {
+		if r.isJSON {
+			r.itemsPath, err = jsonpath.New(spec.Items)
+		} else {
+			r.itemsCSS, err = cascadia.Compile(spec.Items)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "规则 %s: 解析 items 失败", spec.Name)
+		}
+	}
+
+	for _, f := range spec.Fields {
+		fe := fieldExtractor{CaptureField: f, required: f.Required}
+		for _, k := range spec.UpsertKeys {
+			// upsert 键为空时会误更新其它记录
+			fe.required = fe.required || k == f.Name
+		}
+		if f.JSONPath != "" {
+			if !r.isJSON {
+				return nil, errors.Errorf("规则 %s: 字段 %s 的 jsonpath 只能用于 json 响应", spec.Name, f.Name)
+			}
+			if fe.jsonPath, err = jsonpath.New(f.JSONPath); err != nil {
+				return nil, errors.Wrapf(err, "规则 %s: 解析字段 %s 的 jsonpath 失败", spec.Name, f.Name)
+			}
+		}
+		if f.CSS != "" {
+			if r.isJSON {
+				return nil, errors.Errorf("规则 %s: 字段 %s 的 css 只能用于 html 响应", spec.Name, f.Name)
+			}
+			if fe.css, err = cascadia.Compile(f.CSS); err != nil {
+				return nil, errors.Wrapf(err, "规则 %s: 解析字段 %s 的 css 失败", spec.Name, f.Name)
+			}
+		}
+		if f.Regex != "" {
+			fe.regex = regexp.MustCompile(f.Regex)
+		}
+		r.fields = append(r.fields, fe)
+	}
+
+	return r, nil
+}
+
+// Match 按主机、路径、方法、查询参数和响应类型匹配. 请求阶段还没有响应类型, 不做限制
+func (r *DeclarativeRule) Match(ctx *Context) bool {
+	u, err := url.Parse(ctx.URL)
+	if err != nil {
+		return false
+	}
+
+	if r.host != nil && !r.host.Match(hostmatch.WithDefaultPort(u.Host, u.Scheme)) {
+		return false
+	}
+	if r.spec.Path != "" {
+		if ok, _ := path.Match(r.spec.Path, u.Path); !ok {
+			return false
+		}
+	}
+	if r.spec.Method != "" && !strings.EqualFold(r.spec.Method, ctx.Method) {
+		return false
+	}
+
+	query := u.Query()
+	for k, v := range r.spec.Query {
+		if _, ok := query[k]; !ok {
+			return false
+		}
+		if v != "*" && query.Get(k) != v {
+			return false
+		}
+	}
+
+	if ctx.ContentType != "" && !strings.Contains(strings.ToLower(ctx.ContentType), strings.ToLower(r.spec.ContentType)) {
+		return false
+	}
+
+	return true
+}
+
+func (r *DeclarativeRule) HandleResponse(ctx *Context) (Result, error) {
+	u, err := url.Parse(ctx.URL)
+	if err != nil {
+		return Continue, err
+	}
+
+	var docs []map[string]interface{}
+	if r.isJSON {
+		docs, err = r.extractJSON(ctx.Body, u.Query())
+	} else {
+		docs, err = r.extractHTML(ctx.Body, u.Query())
+	}
+	if err != nil {
+		return Continue, err
+	}
+
+	for _, doc := range docs {
+		doc[model.FieldCapturedBy] = ctx.Client
+		if err := r.store.UpsertDocument(ctx.Context(), r.spec.Collection, r.spec.UpsertKeys, doc); err != nil {
+			return Continue, err
+		}
+	}
+	log.Infof("[%s] 保存 %d 条记录到 %s", r.spec.Name, len(docs), r.spec.Collection)
+
+	return Continue, nil
+}
+
+func (r *DeclarativeRule) extractJSON(body []byte, query url.Values) ([]map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return nil, errors.Wrap(err, "解析JSON响应失败")
+	}
+
+	items := []interface{}{root}
+	if r.itemsPath != nil {
+		v, err := r.itemsPath(context.Background(), root)
+		if err != nil {
+			// 路径不存在时没有记录
+			return nil, nil
+		}
+		if list, ok := v.([]interface{}); ok {
+			items = list
+		} else {
+			items = []interface{}{v}
+		}
+	}
+
+	var docs []map[string]interface{}
+	for _, item := range items {
+		doc := make(map[string]interface{})
+		for _, f := range r.fields {
+			var v interface{}
+			switch {
+			case f.Query != "":
+				v = query.Get(f.Query)
+			case f.jsonPath != nil:
+				v, _ = f.jsonPath(context.Background(), item)
+			}
+
+			if f.regex != nil {
+				raw := v
+				if raw == nil && f.Query == "" && f.jsonPath == nil {
+					data, _ := json.Marshal(item)
+					raw = string(data)
+				}
+				v = submatch(f.regex, raw)
+			}
+
+			if !r.setField(doc, f, normalizeJSON(v)) {
+				doc = nil
+				break
+			}
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs, nil
+}
+
+func (r *DeclarativeRule) extractHTML(body []byte, query url.Values) ([]map[string]interface{}, error) {
+	root, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "解析HTML响应失败")
+	}
+
+	items := []*goquery.Selection{root.Selection}
+	if r.itemsCSS != nil {
+		items = nil
+		root.FindMatcher(r.itemsCSS).Each(func(_ int, s *goquery.Selection) {
+			items = append(items, s)
+		})
+	}
+
+	var docs []map[string]interface{}
+	for _, item := range items {
+		doc := make(map[string]interface{})
+		for _, f := range r.fields {
+			var v interface{}
+			switch {
+			case f.Query != "":
+				v = query.Get(f.Query)
+			case f.css != nil:
+				if s := item.FindMatcher(f.css).First(); s.Length() > 0 {
+					if f.Attr != "" {
+						v, _ = s.Attr(f.Attr)
+					} else {
+						v = strings.TrimSpace(s.Text())
+					}
+				}
+			}
+
+			if f.regex != nil {
+				raw := v
+				if raw == nil && f.Query == "" && f.css == nil {
+					if item == root.Selection {
+						raw = string(body)
+					} else {
+						raw, _ = goquery.OuterHtml(item)
+					}
+				}
+				v = submatch(f.regex, raw)
+			}
+
+			if !r.setField(doc, f, v) {
+				doc = nil
+				break
+			}
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs, nil
+}
+
+// setField 写入字段值, 必填字段为空时返回 false
+func (r *DeclarativeRule) setField(doc map[string]interface{}, f fieldExtractor, v interface{}) bool {
+	if v == nil || v == "" {
+		if f.required {
+			return false
+		}
+		v = nil
+	}
+	doc[f.Name] = v
+	return true
+}
+
+// submatch 返回正则的第一个捕获组, 没有匹配时返回 nil
+func submatch(re *regexp.Regexp, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if m := re.FindStringSubmatch(fmt.Sprint(v)); len(m) > 1 {
+		return m[1]
+	}
+	return nil
+}
+
+// normalizeJSON 将 json.Number 转换为整数或浮点数, 便于写入数据库
+func normalizeJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeJSON(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalizeJSON(v[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,167 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"wechat-backup/internal/pkg/options"
+)
+
+func commentRule() options.CaptureRule {
+	return options.CaptureRule{
+		Name:        "comments",
+		Host:        "mp.weixin.qq.com",
+		Path:        "/mp/appmsg_comment",
+		Method:      "GET",
+		Query:       map[string]string{"action": "getcomment", "__biz": "*"},
+		ContentType: "json",
+		Items:       "$.elected_comment[*]",
+		Fields: []options.CaptureField{
+			{Name: "msgBiz", Query: "__biz"},
+			{Name: "contentId", JSONPath: "$.content_id"},
+			{Name: "nickName", JSONPath: "$.nick_name"},
+			{Name: "likeNum", JSONPath: "$.like_num"},
+			{Name: "replyTo", JSONPath: "$.reply.reply_list[0].content"},
+		},
+		Collection: "comments",
+		UpsertKeys: []string{"msgBiz", "contentId"},
+	}
+}
+
+func TestDeclarativeRuleMatch(t *testing.T) {
+	r, err := NewDeclarativeRule(commentRule(), NewMemoryStore())
+	require.NoError(t, err)
+
+	base := "https://mp.weixin.qq.com/mp/appmsg_comment?action=getcomment&__biz=MzA5"
+	tests := []struct {
+		name string
+		ctx  Context
+		want bool
+	}{
+		{"match", Context{URL: base, Method: "GET"}, true},
+		{"match with content type", Context{URL: base, Method: "GET", ContentType: "application/json; charset=UTF-8"}, true},
+		{"wrong content type", Context{URL: base, Method: "GET", ContentType: "text/html"}, false},
+		{"wrong method", Context{URL: base, Method: "POST"}, false},
+		{"wrong host", Context{URL: "https://example.com/mp/appmsg_comment?action=getcomment&__biz=MzA5", Method: "GET"}, false},
+		{"wrong path", Context{URL: "https://mp.weixin.qq.com/mp/appmsg?action=getcomment&__biz=MzA5", Method: "GET"}, false},
+		{"wrong query value", Context{URL: "https://mp.weixin.qq.com/mp/appmsg_comment?action=other&__biz=MzA5", Method: "GET"}, false},
+		{"missing query", Context{URL: "https://mp.weixin.qq.com/mp/appmsg_comment?action=getcomment", Method: "GET"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.Match(&tt.ctx))
+		})
+	}
+
+	// 带端口的主机模式, URL 省略端口时按协议的默认端口匹配
+	spec := commentRule()
+	spec.Host = "mp.weixin.qq.com:443"
+	r, err = NewDeclarativeRule(spec, NewMemoryStore())
+	require.NoError(t, err)
+	assert.True(t, r.Match(&Context{URL: base, Method: "GET"}))
+	assert.True(t, r.Match(&Context{URL: "https://mp.weixin.qq.com:443/mp/appmsg_comment?action=getcomment&__biz=MzA5", Method: "GET"}))
+	assert.False(t, r.Match(&Context{URL: "http://mp.weixin.qq.com/mp/appmsg_comment?action=getcomment&__biz=MzA5", Method: "GET"}))
+}
+
+func TestDeclarativeRuleJSON(t *testing.T) {
+	store := NewMemoryStore()
+	r, err := NewDeclarativeRule(commentRule(), store)
+	require.NoError(t, err)
+
+	body := `{"base_resp":{"ret":0},"elected_comment":[
+		{"content_id":"6000000001","nick_name":"读者甲","like_num":3,"reply":{"reply_list":[{"content":"谢谢"}]}},
+		{"content_id":"6000000002","nick_name":"读者乙","like_num":12345678901},
+		{"nick_name":"缺少ID"}
+	]}`
+	ctx := &Context{
+		URL:    "https://mp.weixin.qq.com/mp/appmsg_comment?action=getcomment&__biz=MzA5",
+		Method: "GET",
+		Body:   []byte(body),
+		Client: "phone1",
+	}
+
+	_, err = r.HandleResponse(ctx)
+	require.NoError(t, err)
+
+	docs := store.Documents("comments")
+	require.Len(t, docs, 2)
+	assert.Equal(t, "MzA5", docs[0]["msgBiz"])
+	assert.Equal(t, "6000000001", docs[0]["contentId"])
+	assert.Equal(t, int64(3), docs[0]["likeNum"])
+	assert.Equal(t, "谢谢", docs[0]["replyTo"])
+	assert.Equal(t, "phone1", docs[0]["capturedBy"])
+	assert.Equal(t, int64(12345678901), docs[1]["likeNum"])
+	assert.Nil(t, docs[1]["replyTo"])
+
+	// 相同的 upsert 键更新已有记录
+	ctx.Body = []byte(`{"elected_comment":[{"content_id":"6000000001","nick_name":"读者甲","like_num":4}]}`)
+	_, err = r.HandleResponse(ctx)
+	require.NoError(t, err)
+
+	docs = store.Documents("comments")
+	require.Len(t, docs, 2)
+	assert.Equal(t, int64(4), docs[0]["likeNum"])
+}
+
+func TestDeclarativeRuleHTML(t *testing.T) {
+	store := NewMemoryStore()
+	r, err := NewDeclarativeRule(options.CaptureRule{
+		Name:        "album",
+		Path:        "/mp/appmsgalbum",
+		ContentType: "html",
+		Items:       "li.album__list-item",
+		Fields: []options.CaptureField{
+			{Name: "albumId", Query: "album_id"},
+			{Name: "msgId", CSS: "li", Attr: "data-msgid"},
+			{Name: "title", CSS: ".album__item-title-wrp"},
+			{Name: "link", CSS: "a", Attr: "href"},
+			{Name: "mid", Regex: `mid=(\d+)`},
+		},
+		Collection: "albums",
+		UpsertKeys: []string{"albumId", "title"},
+	}, store)
+	require.NoError(t, err)
+
+	body := `<html><body><ul>
+		<li class="album__list-item" data-msgid="1"><a href="https://mp.weixin.qq.com/s?mid=2650000001&amp;idx=1"><span class="album__item-title-wrp"> 第一篇 </span></a></li>
+		<li class="album__list-item" data-msgid="2"><a href="https://mp.weixin.qq.com/s?mid=2650000002&amp;idx=1"><span class="album__item-title-wrp">第二篇</span></a></li>
+		<li class="album__list-item"><span>没有标题</span></li>
+	</ul></body></html>`
+	_, err = r.HandleResponse(&Context{
+		URL:  "https://mp.weixin.qq.com/mp/appmsgalbum?action=getalbum&album_id=100",
+		Body: []byte(body),
+	})
+	require.NoError(t, err)
+
+	docs := store.Documents("albums")
+	require.Len(t, docs, 2)
+	assert.Equal(t, "100", docs[0]["albumId"])
+	assert.Equal(t, "第一篇", docs[0]["title"])
+	assert.Equal(t, "https://mp.weixin.qq.com/s?mid=2650000001&idx=1", docs[0]["link"])
+	assert.Equal(t, "2650000001", docs[0]["mid"])
+	// 选择器相对于记录, 记录本身不参与匹配
+	assert.Nil(t, docs[0]["msgId"])
+}
+
+func TestNewDeclarativeRuleInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *options.CaptureRule)
+	}{
+		{"missing name", func(r *options.CaptureRule) { r.Name = "" }},
+		{"bad content type", func(r *options.CaptureRule) { r.ContentType = "xml" }},
+		{"unknown upsert key", func(r *options.CaptureRule) { r.UpsertKeys = []string{"missing"} }},
+		{"bad jsonpath", func(r *options.CaptureRule) { r.Fields[1].JSONPath = "$.[" }},
+		{"css on json", func(r *options.CaptureRule) { r.Fields[1] = options.CaptureField{Name: "contentId", CSS: "div"} }},
+		{"regex without group", func(r *options.CaptureRule) { r.Fields[1] = options.CaptureField{Name: "contentId", Regex: `\d+`} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := commentRule()
+			tt.modify(&spec)
+			_, err := NewDeclarativeRule(spec, NewMemoryStore())
+			assert.Error(t, err)
+		})
+	}
+}
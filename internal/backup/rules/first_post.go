@@ -1,14 +1,10 @@
 package rules
 
 import (
-	"context"
 	"encoding/json"
 	"github.com/marmotedu/log"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/url"
 	"time"
-	"wechat-backup/internal/pkg/mongo"
 )
 
 // FirstPostRule 处理公众号文章列表已经刷新到第一篇的消息
@@ -16,19 +12,22 @@ type FirstPostRule struct {
 	BaseRule
 }
 
-func NewFirstPostRule() *FirstPostRule {
+func NewFirstPostRule(store Store) *FirstPostRule {
 	return &FirstPostRule{
 		BaseRule{
 			ruleType:   "first_post",
 			urlPattern: "/wx/profiles/first_post",
+			store:      store,
+			priority:   PriorityFirstPost,
 		},
 	}
 }
 
-func (r *FirstPostRule) Handle(ctx *Context) error {
+// HandleRequest 由代理直接应答, 不再请求上游
+func (r *FirstPostRule) HandleRequest(ctx *Context) (Result, error) {
 	// 只处理POST请求
 	if ctx.Method != "POST" {
-		return nil
+		return Continue, nil
 	}
 
 	// 解析请求体
@@ -36,40 +35,28 @@ func (r *FirstPostRule) Handle(ctx *Context) error {
 		Link      string `json:"link"`
 		PublishAt int64  `json:"publishAt"`
 	}
-	if err := json.Unmarshal(ctx.Body, &data); err != nil {
-		return err
+	if err := json.Unmarshal(ctx.RequestBody, &data); err != nil {
+		return Continue, err
 	}
 
 	// 解析URL获取msgBiz
 	u, err := url.Parse(data.Link)
 	if err != nil {
-		return err
+		return Continue, err
 	}
 	msgBiz := u.Query().Get("__biz")
 
 	// 更新数据库
-	db := mongo.GetMongoDB()
-	collection := db.Collection("profiles")
-
-	filter := bson.M{"msgBiz": msgBiz}
-	update := bson.M{
-		"$set": bson.M{
-			"firstPublishAt": time.Unix(data.PublishAt/1000, 0),
-			"updatedAt":      time.Now(),
-		},
-	}
-
-	opts := options.Update().SetUpsert(true)
-	_, err = collection.UpdateOne(context.Background(), filter, update, opts)
-	if err != nil {
-		return err
+	if err = r.store.UpdateProfileFirstPublishAt(ctx.Context(), msgBiz, time.Unix(data.PublishAt/1000, 0)); err != nil {
+		return Continue, err
 	}
 
 	log.Infof("==========>公众号 %s 更新firstPublishAt 成功", msgBiz)
 
 	// 设置响应
 	ctx.Body = []byte("ok")
-	ctx.Headers["Content-Type"] = "text/plain"
+	ctx.ContentType = "text/plain"
+	ctx.Reply = true
 
-	return nil
+	return Stop, nil
 }
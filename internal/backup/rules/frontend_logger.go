@@ -16,14 +16,16 @@ func NewFrontendLoggerRule() *FrontendLoggerRule {
 		BaseRule{
 			ruleType:   RuleTypeLogger,
 			urlPattern: "/wx/front_end_logger",
+			priority:   PriorityLogger,
 		},
 	}
 }
 
-func (r *FrontendLoggerRule) Handle(ctx *Context) error {
+// HandleRequest 由代理直接应答, 不再请求上游
+func (r *FrontendLoggerRule) HandleRequest(ctx *Context) (Result, error) {
 	// 只处理POST请求
 	if ctx.Method != "POST" {
-		return nil
+		return Continue, nil
 	}
 
 	// 解析请求体
@@ -31,11 +33,15 @@ func (r *FrontendLoggerRule) Handle(ctx *Context) error {
 		Message string `json:"message"`
 	}
 	if err := json.Unmarshal(ctx.RequestBody, &data); err != nil {
-		return errors.Wrap(err, "解析内容")
+		return Continue, errors.Wrap(err, "解析内容")
 	}
 
 	// 记录日志
 	log.Debugf("============>[frontend] %s", data.Message)
 
-	return nil
+	ctx.Body = []byte("ok")
+	ctx.ContentType = "text/plain"
+	ctx.Reply = true
+
+	return Stop, nil
 }
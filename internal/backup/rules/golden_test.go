@@ -0,0 +1,141 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 样本目录, 每个样本由以下文件组成:
+//
+//	<名称>.html 或 <名称>.json  抓取到的响应体(已脱敏)
+//	<名称>.url                  请求地址
+//	<名称>.golden.json          期望的规则处理结果, 由 -update 生成
+//
+// 新样本可以用 `wx-backup fixture` 命令从抓取的页面或 HAR 文件生成.
+// 端到端测试的假服务(fakewechat)也从这里读取页面, 没有 .url 的样本(如 getappmsgext.json)只供假服务使用.
+const goldenDir = "testdata/golden"
+
+var update = flag.Bool("update", false, "用当前的解析结果覆盖 golden 文件")
+
+// 不稳定的字段, 比较前从结果中移除
+var volatileFields = map[string]bool{
+	"createdAt":         true,
+	"updatedAt":         true,
+	"openHistoryPageAt": true,
+	"html":              true,
+}
+
+// goldenResult 一个样本经过规则处理后的结果
+type goldenResult struct {
+	Rules  []RuleType   `json:"rules"`
+	Error  string       `json:"error,omitempty"`
+	Writes []StoreWrite `json:"writes"`
+}
+
+func TestMain(m *testing.M) {
+	// 发布时间按 UTC 输出, 避免 golden 文件依赖本地时区
+	time.Local = time.UTC
+	os.Exit(m.Run())
+}
+
+func TestGolden(t *testing.T) {
+	urls, err := filepath.Glob(filepath.Join(goldenDir, "*.url"))
+	require.NoError(t, err)
+	require.NotEmpty(t, urls)
+
+	for _, urlFile := range urls {
+		name := strings.TrimSuffix(filepath.Base(urlFile), ".url")
+		t.Run(name, func(t *testing.T) {
+			link, err := os.ReadFile(urlFile)
+			require.NoError(t, err)
+
+			body, err := readGoldenBody(name)
+			require.NoError(t, err)
+
+			got := runGolden(t, strings.TrimSpace(string(link)), body)
+
+			goldenFile := filepath.Join(goldenDir, name+".golden.json")
+			if *update {
+				require.NoError(t, os.WriteFile(goldenFile, got, 0o644))
+				return
+			}
+
+			want, err := os.ReadFile(goldenFile)
+			require.NoError(t, err, "缺少 golden 文件, 使用 -update 生成")
+			assert.Equal(t, string(want), string(got))
+		})
+	}
+}
+
+func readGoldenBody(name string) ([]byte, error) {
+	for _, ext := range []string{".html", ".json"} {
+		body, err := os.ReadFile(filepath.Join(goldenDir, name+ext))
+		if err == nil || !os.IsNotExist(err) {
+			return body, err
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// runGolden 用内存存储运行全部规则, 返回规范化后的 JSON
+func runGolden(t *testing.T, link string, body []byte) []byte {
+	t.Helper()
+
+	store := NewMemoryStore()
+	manager := NewManager(store, nil, nil)
+	ctx := &Context{
+		URL:     link,
+		Method:  "GET",
+		Headers: map[string]string{},
+		Body:    body,
+	}
+
+	var result goldenResult
+	for _, rule := range manager.Matched(ctx) {
+		result.Rules = append(result.Rules, rule.Type())
+	}
+	if err := manager.HandleResponse(ctx); err != nil {
+		result.Error = err.Error()
+	}
+	result.Writes = store.TakeWrites()
+
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+
+	var v interface{}
+	require.NoError(t, json.Unmarshal(data, &v))
+	stripVolatile(v)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	require.NoError(t, enc.Encode(v))
+	return buf.Bytes()
+}
+
+func stripVolatile(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if volatileFields[k] {
+				delete(v, k)
+				continue
+			}
+			stripVolatile(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			stripVolatile(child)
+		}
+	}
+}
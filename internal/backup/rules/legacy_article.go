@@ -0,0 +1,131 @@
+package rules
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/util/html"
+	"wechat-backup/internal/pkg/wxlink"
+)
+
+// 旧版图文消息页面 /mp/appmsg/show: 文章标识的参数为 appmsgid 和 itemidx,
+// 页面变量多用单引号, 标题、发布日期和公众号名称在页头的 activity-name、post-date、post-user 中
+var (
+	legacyTitlePattern   = regexp.MustCompile(`(?s)<h1[^>]*id=["']activity-name["'][^>]*>(.*?)</h1>`)
+	legacyDatePattern    = regexp.MustCompile(`<[^>]*id=["']post-date["'][^>]*>\s*(\d{4}-\d{2}-\d{2})\s*<`)
+	legacyUserPattern    = regexp.MustCompile(`(?s)<a[^>]*id=["']post-user["'][^>]*>(.*?)</a>`)
+	legacySourcePattern  = regexp.MustCompile(`<a[^>]*id=["']js_view_source["'][^>]*href=["']([^"']+)["']`)
+	legacyContentPattern = regexp.MustCompile(`(?s)<div[^>]*id=["']js_content["'][^>]*>(.*?)</div>`)
+	tagPattern           = regexp.MustCompile(`<[^>]+>`)
+)
+
+// isLegacyArticle 是否为旧版图文消息页面
+func isLegacyArticle(link string) bool {
+	return strings.Contains(link, "/mp/appmsg/show")
+}
+
+// 旧版页面中读取的变量
+var (
+	legacyBizVar          = legacyVarPattern("biz")
+	legacyAppmsgidVar     = legacyVarPattern("appmsgid")
+	legacyMidVar          = legacyVarPattern("mid")
+	legacyItemidxVar      = legacyVarPattern("itemidx")
+	legacyIdxVar          = legacyVarPattern("idx")
+	legacyCtVar           = legacyVarPattern("ct")
+	legacyMsgTitleVar     = legacyVarPattern("msg_title")
+	legacyMsgDescVar      = legacyVarPattern("msg_desc")
+	legacyMsgCdnURLVar    = legacyVarPattern("msg_cdn_url")
+	legacyMsgSourceURLVar = legacyVarPattern("msg_source_url")
+	legacySourceURLVar    = legacyVarPattern("source_url")
+	legacyNicknameVar     = legacyVarPattern("nickname")
+	legacyUserNameVar     = legacyVarPattern("user_name")
+	legacyReadNumVar      = legacyVarPattern("read_num")
+	legacyLikeNumVar      = legacyVarPattern("like_num")
+)
+
+// legacyVarPattern 页面变量的正则, 支持单双引号和 `"" || "值"` 的写法
+func legacyVarPattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`var ` + regexp.QuoteMeta(name) + `\s*=\s*(?:"([^"]*)"|'([^']*)')(?:\s*\|\|\s*(?:"([^"]*)"|'([^']*)'))?`)
+}
+
+// legacyVar 读取页面变量, 取第一个非空的值
+func legacyVar(content string, re *regexp.Regexp) string {
+	if matches := re.FindStringSubmatch(content); len(matches) > 1 {
+		return firstNonEmpty(matches[1:]...)
+	}
+	return ""
+}
+
+// parseLegacyPostDetail 解析旧版图文消息页面
+func parseLegacyPostDetail(link string, content string) (*model.Post, error) {
+	msgBiz, msgMid, msgIdx, err := linkPostKey(link)
+	if err != nil {
+		return nil, err
+	}
+	msgBiz = firstNonEmpty(msgBiz, legacyVar(content, legacyBizVar))
+	msgMid = firstNonEmpty(msgMid, legacyVar(content, legacyAppmsgidVar), legacyVar(content, legacyMidVar))
+	msgIdx = firstNonEmpty(msgIdx, legacyVar(content, legacyItemidxVar), legacyVar(content, legacyIdxVar))
+
+	title := html.UnescapeHTML(legacyVar(content, legacyMsgTitleVar))
+	if title == "" {
+		if matches := legacyTitlePattern.FindStringSubmatch(content); len(matches) > 1 {
+			title = html.UnescapeHTML(strings.TrimSpace(tagPattern.ReplaceAllString(matches[1], "")))
+		}
+	}
+
+	// 发布时间: ct 为时间戳, 没有时使用页头的日期
+	var publishAt time.Time
+	if ct := parseInt64(legacyVar(content, legacyCtVar)); ct > 0 {
+		publishAt = time.Unix(ct, 0)
+	} else if matches := legacyDatePattern.FindStringSubmatch(content); len(matches) > 1 {
+		publishAt, _ = time.ParseInLocation("2006-01-02", matches[1], time.Local)
+	}
+
+	nickname := html.UnescapeHTML(legacyVar(content, legacyNicknameVar))
+	if nickname == "" {
+		if matches := legacyUserPattern.FindStringSubmatch(content); len(matches) > 1 {
+			nickname = html.UnescapeHTML(strings.TrimSpace(tagPattern.ReplaceAllString(matches[1], "")))
+		}
+	}
+
+	sourceURL := firstNonEmpty(legacyVar(content, legacySourceURLVar), legacyVar(content, legacyMsgSourceURLVar))
+	if sourceURL == "" {
+		if matches := legacySourcePattern.FindStringSubmatch(content); len(matches) > 1 {
+			sourceURL = html.UnescapeHTML(matches[1])
+		}
+	}
+
+	var text string
+	if matches := legacyContentPattern.FindStringSubmatch(content); len(matches) > 1 {
+		text = cleanContent(matches[1])
+	}
+
+	post := &model.Post{
+		MsgBiz:    msgBiz,
+		MsgMid:    msgMid,
+		MsgIdx:    msgIdx,
+		Title:     title,
+		Link:      wxlink.Canonical(link),
+		Cover:     html.UnescapeHTML(legacyVar(content, legacyMsgCdnURLVar)),
+		Digest:    html.UnescapeHTML(legacyVar(content, legacyMsgDescVar)),
+		Content:   text,
+		HTML:      wxlink.Redact(content),
+		PublishAt: publishAt,
+		WechatId:  nickname,
+		Username:  legacyVar(content, legacyUserNameVar),
+		SourceURL: sourceURL,
+		ReadNum:   parseInt64(legacyVar(content, legacyReadNumVar)),
+		LikeNum:   parseInt64(legacyVar(content, legacyLikeNumVar)),
+	}
+	return post, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
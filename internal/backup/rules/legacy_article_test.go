@@ -0,0 +1,22 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLegacyVar(t *testing.T) {
+	content := `var biz = "" || "MzA5";
+var msg_title = 'a "title"';
+var appmsgid = '' || '10000006';
+var midx = "wrong";`
+
+	assert.Equal(t, "MzA5", legacyVar(content, legacyBizVar))
+	assert.Equal(t, `a "title"`, legacyVar(content, legacyMsgTitleVar))
+	assert.Equal(t, "10000006", legacyVar(content, legacyAppmsgidVar))
+	// 不匹配名称以 mid 开头的其它变量
+	assert.Empty(t, legacyVar(content, legacyMidVar))
+	// 变量名中的正则元字符按字面匹配
+	assert.Empty(t, legacyVar(`var a_b = "x";`, legacyVarPattern("a.b")))
+}
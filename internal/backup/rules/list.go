@@ -14,19 +14,21 @@ type ListRule struct {
 	BaseRule
 }
 
-func NewListRule() *ListRule {
+func NewListRule(store Store) *ListRule {
 	return &ListRule{
 		BaseRule{
 			ruleType:   RuleTypeList,
 			urlPattern: "/mp/profile_ext?action=getmsg",
+			store:      store,
+			priority:   PriorityList,
 		},
 	}
 }
 
-func (r *ListRule) Handle(ctx *Context) error {
+func (r *ListRule) HandleResponse(ctx *Context) (Result, error) {
 	// 只处理GET请求
 	if ctx.Method != "GET" {
-		return nil
+		return Continue, nil
 	}
 
 	// 解析响应数据
@@ -34,7 +36,7 @@ func (r *ListRule) Handle(ctx *Context) error {
 		GeneralMsgList string `json:"general_msg_list"`
 	}
 	if err := json.Unmarshal(ctx.Body, &resp); err != nil {
-		return errors.Wrap(err, "解析响应数据失败")
+		return Continue, errors.Wrap(err, "解析响应数据失败")
 	}
 
 	// 清理内容
@@ -47,7 +49,7 @@ func (r *ListRule) Handle(ctx *Context) error {
 	// 解析文章数据
 	var data model.ArticleList
 	if err := json.Unmarshal([]byte(cleanContent), &data); err != nil {
-		return errors.Wrap(err, "解析文章列表失败")
+		return Continue, errors.Wrap(err, "解析文章列表失败")
 	}
 
 	// 保存文章
@@ -59,6 +61,7 @@ func (r *ListRule) Handle(ctx *Context) error {
 		if item.AppMsgExtInfo.Title != "" && item.AppMsgExtInfo.ContentURL != "" {
 			post := buildPost(item.AppMsgExtInfo, publishAt)
 			if post != nil {
+				post.CapturedBy = ctx.Client
 				posts = append(posts, post)
 			}
 		}
@@ -68,6 +71,7 @@ func (r *ListRule) Handle(ctx *Context) error {
 			if multiItem.Title != "" && multiItem.ContentURL != "" {
 				post := buildPost(multiItem, publishAt)
 				if post != nil {
+					post.CapturedBy = ctx.Client
 					posts = append(posts, post)
 				}
 			}
@@ -75,5 +79,11 @@ func (r *ListRule) Handle(ctx *Context) error {
 	}
 
 	// 保存文章到数据库
-	return savePostsToDB(posts)
+	result, err := savePosts(ctx.Context(), r.store, posts)
+	// 无序写入时部分文章可能已经保存, 失败时同样输出汇总
+	logSaveResult("列表页", posts, result)
+	if err != nil {
+		return Continue, err
+	}
+	return Continue, nil
 }
@@ -1,35 +1,211 @@
 package rules
 
-// Manager 规则管理器
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+	"wechat-backup/internal/pkg/wxlink"
+)
+
+// Manager 规则管理器. 在启动时创建一次, 之后可以被多个请求并发使用.
+// 规则按优先级依次执行, 单个规则出错、超时或 panic 只影响该规则本身:
+// 它对上下文的修改会被丢弃, 后续规则照常执行.
 type Manager struct {
+	mtx   sync.RWMutex
 	rules []Rule
+
+	// 超时后被放弃的执行次数, 以及其中还没有结束的数量
+	abandoned        atomic.Uint64
+	abandonedRunning atomic.Int64
+}
+
+// ManagerStats 规则执行的统计
+type ManagerStats struct {
+	Abandoned        uint64 `json:"abandoned"`        // 超时后被放弃的执行次数
+	AbandonedRunning int64  `json:"abandonedRunning"` // 被放弃后仍在执行的数量
+}
+
+// Stats 返回规则执行的统计
+func (m *Manager) Stats() ManagerStats {
+	return ManagerStats{
+		Abandoned:        m.abandoned.Load(),
+		AbandonedRunning: m.abandonedRunning.Load(),
+	}
 }
 
-func NewManager() *Manager {
+// NewManager 创建规则管理器并注册默认规则, 文章交给 pool 异步保存, pool 为空时同步保存.
+// sealer 不为空时加密保存文章的原始链接
+func NewManager(store Store, pool *ArticlePool, sealer *wxlink.Sealer) *Manager {
 	m := &Manager{}
 	// 注册默认规则
 	m.Register(
-		NewProfileRule(),
+		NewProfileRule(store),
 		NewFrontendLoggerRule(),
-		NewFirstPostRule(),
+		NewFirstPostRule(store),
 		NewNextLinkRule(),
-		NewListRule(),
-		NewContentRule(),
+		NewListRule(store),
+		NewContentRule(store, pool, sealer),
 	)
 	return m
 }
 
+// Register 注册规则并按优先级重新排序
 func (m *Manager) Register(rules ...Rule) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
 	m.rules = append(m.rules, rules...)
+	sort.SliceStable(m.rules, func(i, j int) bool {
+		return m.rules[i].Priority() < m.rules[j].Priority()
+	})
 }
 
-func (m *Manager) Handle(ctx *Context) error {
+// Matched 返回匹配该上下文的规则, 包括两个阶段
+func (m *Manager) Matched(ctx *Context) []Rule {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	var matched []Rule
 	for _, rule := range m.rules {
 		if rule.Match(ctx) {
-			if err := rule.Handle(ctx); err != nil {
-				return err
-			}
+			matched = append(matched, rule)
 		}
 	}
+	return matched
+}
+
+// HandleRequest 执行请求阶段的规则
+func (m *Manager) HandleRequest(ctx *Context) error {
+	return m.handle(ctx, "request", requestHook)
+}
+
+// HandleResponse 执行响应阶段的规则
+func (m *Manager) HandleResponse(ctx *Context) error {
+	return m.handle(ctx, "response", responseHook)
+}
+
+// HasRequestHandler 是否有匹配的请求阶段规则, 没有时不需要读取请求体
+func (m *Manager) HasRequestHandler(ctx *Context) bool {
+	return m.has(ctx, requestHook)
+}
+
+// HasResponseHandler 是否有匹配的响应阶段规则, 没有时不需要读取响应体
+func (m *Manager) HasResponseHandler(ctx *Context) bool {
+	return m.has(ctx, responseHook)
+}
+
+func requestHook(rule Rule) func(*Context) (Result, error) {
+	if h, ok := rule.(RequestHandler); ok {
+		return h.HandleRequest
+	}
+	return nil
+}
+
+func responseHook(rule Rule) func(*Context) (Result, error) {
+	if h, ok := rule.(ResponseHandler); ok {
+		return h.HandleResponse
+	}
 	return nil
 }
+
+// has 是否有匹配的规则实现了该阶段的处理
+func (m *Manager) has(ctx *Context, hook func(Rule) func(*Context) (Result, error)) bool {
+	for _, rule := range m.Matched(ctx) {
+		if hook(rule) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// handle 依次执行匹配的规则, 返回所有规则的错误
+func (m *Manager) handle(ctx *Context, phase string, hook func(Rule) func(*Context) (Result, error)) error {
+	var errs []error
+	for _, rule := range m.Matched(ctx) {
+		fn := hook(rule)
+		if fn == nil {
+			continue
+		}
+
+		result, err := m.run(ctx, rule, fn)
+		if err != nil {
+			log.Errorf("[%s] 规则 %s 处理失败: %+v", phase, rule.Type(), err)
+			errs = append(errs, errors.Errorf("规则 %s: %v", rule.Type(), err))
+			continue
+		}
+
+		if result == Stop {
+			log.Debugf("[%s] 规则 %s 停止后续规则", phase, rule.Type())
+			break
+		}
+	}
+
+	return errors.NewAggregate(errs)
+}
+
+// 规则执行的状态
+const (
+	runPending int32 = iota
+	runFinished
+	runAbandoned
+)
+
+// run 在上下文副本上执行规则, 成功后写回. 超时后取消规则的上下文并放弃等待:
+// 规则应当在上下文取消后尽快返回, 它的结果被丢弃, 结束时记录日志
+func (m *Manager) run(ctx *Context, rule Rule, fn func(*Context) (Result, error)) (Result, error) {
+	type outcome struct {
+		result Result
+		err    error
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx.Context(), rule.Timeout())
+	defer cancel()
+
+	cp := ctx.clone()
+	cp.ctx = runCtx
+	var state atomic.Int32
+	done := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		defer func() {
+			if r := recover(); r != nil {
+				o = outcome{err: fmt.Errorf("panic: %v", r)}
+			}
+			if !state.CompareAndSwap(runPending, runFinished) {
+				m.abandonedRunning.Add(-1)
+				log.Warnf("规则 %s 超时后执行结束, 结果已丢弃: %v", rule.Type(), o.err)
+			}
+			done <- o
+		}()
+
+		o.result, o.err = fn(cp)
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil {
+			return Continue, o.err
+		}
+		parent := ctx.ctx
+		*ctx = *cp
+		ctx.ctx = parent
+		return o.result, nil
+	case <-runCtx.Done():
+	}
+
+	// 等待结束的同时规则恰好执行完, 仍按超时处理, 结果被丢弃
+	if state.CompareAndSwap(runPending, runAbandoned) {
+		m.abandoned.Add(1)
+		m.abandonedRunning.Add(1)
+		log.Warnf("规则 %s 超时, 放弃等待, 已累计放弃 %d 次", rule.Type(), m.abandoned.Load())
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return Continue, errors.Errorf("超时(%s)", rule.Timeout())
+	}
+	return Continue, errors.Wrap(runCtx.Err(), "已取消")
+}
@@ -0,0 +1,205 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"wechat-backup/internal/model"
+)
+
+// testRule 记录执行顺序的测试规则
+type testRule struct {
+	BaseRule
+	name   string
+	calls  *[]string
+	result Result
+	err    error
+	panics bool
+	sleep  time.Duration
+}
+
+func newTestRule(name string, priority int, calls *[]string) *testRule {
+	return &testRule{
+		BaseRule: BaseRule{ruleType: RuleType(name), urlPattern: "/test", priority: priority},
+		name:     name,
+		calls:    calls,
+	}
+}
+
+func (r *testRule) handle(ctx *Context) (Result, error) {
+	time.Sleep(r.sleep)
+	if r.panics {
+		panic("boom")
+	}
+	*r.calls = append(*r.calls, r.name)
+	ctx.Body = append(ctx.Body, r.name...)
+	return r.result, r.err
+}
+
+// requestRule 只在请求阶段执行
+type requestRule struct{ *testRule }
+
+func (r requestRule) HandleRequest(ctx *Context) (Result, error) { return r.handle(ctx) }
+
+// contextRule 等待上下文取消, 并报告取消的原因
+type contextRule struct {
+	*testRule
+	canceled chan error
+}
+
+func (r contextRule) HandleResponse(ctx *Context) (Result, error) {
+	<-ctx.Context().Done()
+	r.canceled <- ctx.Context().Err()
+	return Continue, nil
+}
+
+// responseRule 只在响应阶段执行
+type responseRule struct{ *testRule }
+
+func (r responseRule) HandleResponse(ctx *Context) (Result, error) { return r.handle(ctx) }
+
+func TestManagerPriority(t *testing.T) {
+	var calls []string
+	m := &Manager{}
+	m.Register(
+		responseRule{newTestRule("c", 10, &calls)},
+		responseRule{newTestRule("a", -10, &calls)},
+		responseRule{newTestRule("b", 0, &calls)},
+		responseRule{newTestRule("b2", 0, &calls)},
+	)
+
+	ctx := &Context{URL: "https://mp.weixin.qq.com/test"}
+	require.NoError(t, m.HandleResponse(ctx))
+	assert.Equal(t, []string{"a", "b", "b2", "c"}, calls)
+	assert.Equal(t, "abb2c", string(ctx.Body))
+}
+
+func TestManagerBuiltinPriority(t *testing.T) {
+	m := NewManager(NewMemoryStore(), nil, nil)
+	var calls []string
+	m.Register(responseRule{newTestRule("capture", DefaultPriority, &calls)})
+
+	var types []RuleType
+	for _, r := range m.rules {
+		types = append(types, r.Type())
+	}
+	// 资料和列表先于文章内容, 声明式规则在内置的保存规则之后, 跳转链接最后
+	assert.Equal(t, []RuleType{RuleTypeLogger, RuleTypeProfile, RuleTypeList, "first_post", RuleTypeContent, "capture", "next_link"}, types)
+}
+
+func TestManagerStop(t *testing.T) {
+	var calls []string
+	stop := newTestRule("stop", 0, &calls)
+	stop.result = Stop
+
+	m := &Manager{}
+	m.Register(responseRule{stop}, responseRule{newTestRule("after", 1, &calls)})
+
+	require.NoError(t, m.HandleResponse(&Context{URL: "/test"}))
+	assert.Equal(t, []string{"stop"}, calls)
+}
+
+func TestManagerIsolation(t *testing.T) {
+	var calls []string
+	failing := newTestRule("failing", 0, &calls)
+	failing.err = errors.New("failed")
+	panicking := newTestRule("panicking", 1, &calls)
+	panicking.panics = true
+	// 超时的规则仍在后台执行, 使用单独的记录避免并发写
+	var slowCalls []string
+	slow := newTestRule("slow", 2, &slowCalls)
+	slow.sleep = 200 * time.Millisecond
+	slow.timeout = 10 * time.Millisecond
+
+	m := &Manager{}
+	m.Register(responseRule{failing}, responseRule{panicking}, responseRule{slow}, responseRule{newTestRule("ok", 3, &calls)})
+
+	ctx := &Context{URL: "/test", Headers: map[string]string{}}
+	err := m.HandleResponse(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "规则 failing: failed")
+	assert.Contains(t, err.Error(), "规则 panicking: panic: boom")
+	assert.Contains(t, err.Error(), "规则 slow: 超时")
+
+	// 失败规则的修改被丢弃, 后续规则照常执行
+	assert.Equal(t, "ok", string(ctx.Body))
+
+	// 超时的规则在结束前计入仍在执行的数量
+	assert.Equal(t, ManagerStats{Abandoned: 1, AbandonedRunning: 1}, m.Stats())
+	assert.Eventually(t, func() bool { return m.Stats().AbandonedRunning == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "ok", string(ctx.Body))
+}
+
+func TestManagerCancelsTimedOutRule(t *testing.T) {
+	canceled := make(chan error, 1)
+	var calls []string
+	slow := newTestRule("slow", 0, &calls)
+	slow.timeout = 10 * time.Millisecond
+
+	m := &Manager{}
+	m.Register(contextRule{slow, canceled})
+
+	ctx := &Context{URL: "/test"}
+	err := m.HandleResponse(ctx)
+	assert.ErrorContains(t, err, "超时")
+
+	// 规则的上下文在超时后被取消, 调用方的上下文不受影响
+	select {
+	case err := <-canceled:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("规则的上下文没有被取消")
+	}
+	assert.NoError(t, ctx.Context().Err())
+}
+
+func TestManagerPhases(t *testing.T) {
+	var calls []string
+	m := &Manager{}
+	m.Register(requestRule{newTestRule("req", 0, &calls)}, responseRule{newTestRule("resp", 0, &calls)})
+
+	ctx := &Context{URL: "/test"}
+	require.NoError(t, m.HandleRequest(ctx))
+	assert.Equal(t, []string{"req"}, calls)
+
+	require.NoError(t, m.HandleResponse(ctx))
+	assert.Equal(t, []string{"req", "resp"}, calls)
+	assert.Len(t, m.Matched(ctx), 2)
+}
+
+func TestManagerHasHandler(t *testing.T) {
+	var calls []string
+	m := &Manager{}
+	m.Register(requestRule{newTestRule("req", 0, &calls)})
+
+	assert.True(t, m.HasRequestHandler(&Context{URL: "/test"}))
+	assert.False(t, m.HasResponseHandler(&Context{URL: "/test"}))
+	assert.False(t, m.HasRequestHandler(&Context{URL: "/other"}))
+
+	// 默认规则只需要文章、历史消息等页面的消息体
+	m = NewManager(NewMemoryStore(), nil, nil)
+	assert.True(t, m.HasResponseHandler(&Context{URL: "https://mp.weixin.qq.com/s?__biz=MzA5&mid=1&idx=1", Method: "GET"}))
+	assert.False(t, m.HasRequestHandler(&Context{URL: "https://mp.weixin.qq.com/s?__biz=MzA5&mid=1&idx=1", Method: "GET"}))
+	assert.False(t, m.HasResponseHandler(&Context{URL: "https://mp.weixin.qq.com/mp/videoplayer?vid=1", Method: "GET"}))
+}
+
+func TestFirstPostRuleReplies(t *testing.T) {
+	store := NewMemoryStore()
+	require.NoError(t, store.SaveProfile(context.Background(), &model.Profile{MsgBiz: "MzA5"}))
+
+	ctx := &Context{
+		URL:         "https://mp.weixin.qq.com/wx/profiles/first_post",
+		Method:      "POST",
+		Headers:     map[string]string{},
+		RequestBody: []byte(`{"link":"https://mp.weixin.qq.com/mp/profile_ext?action=home&__biz=MzA5","publishAt":1704067200000}`),
+	}
+	require.NoError(t, NewManager(store, nil, nil).HandleRequest(ctx))
+
+	assert.True(t, ctx.Reply)
+	assert.Equal(t, "ok", string(ctx.Body))
+	assert.Equal(t, int64(1704067200), store.Profiles()[0].FirstPublishAt.Unix())
+}
@@ -0,0 +1,428 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+	"wechat-backup/internal/model"
+)
+
+// StoreWrite 一次写入操作
+type StoreWrite struct {
+	Op   string      `json:"op"`   // 操作名, 与 Store 的方法名一致
+	Data interface{} `json:"data"` // 写入的数据
+}
+
+// MemoryStore 内存存储, 语义与 MongoDB 存储一致, 并记录所有写入操作.
+// 用于离线回放和测试.
+type MemoryStore struct {
+	mtx      sync.Mutex
+	profiles map[string]*model.Profile
+	posts    map[string]*model.Post
+	docs     map[string][]map[string]interface{}
+	dead     []*model.DeadLetter
+	short    map[string]*model.ShortLink
+	writes   []StoreWrite
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		profiles: make(map[string]*model.Profile),
+		posts:    make(map[string]*model.Post),
+		docs:     make(map[string][]map[string]interface{}),
+		short:    make(map[string]*model.ShortLink),
+	}
+}
+
+func postKey(msgBiz, msgMid, msgIdx string) string {
+	return msgBiz + "/" + msgMid + "/" + msgIdx
+}
+
+// mergeString 新值非空时覆盖
+func mergeString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// mergeTime 新值非零时覆盖
+func mergeTime(dst *time.Time, v time.Time) {
+	if !v.IsZero() {
+		*dst = v
+	}
+}
+
+func (s *MemoryStore) record(op string, data interface{}) {
+	s.writes = append(s.writes, StoreWrite{Op: op, Data: data})
+}
+
+// profile 返回公众号资料, 不存在时创建
+func (s *MemoryStore) profile(msgBiz string) *model.Profile {
+	p, ok := s.profiles[msgBiz]
+	if !ok {
+		p = &model.Profile{MsgBiz: msgBiz}
+		p.CreatedAt = time.Now()
+		s.profiles[msgBiz] = p
+	}
+	return p
+}
+
+// post 返回文章, 不存在时创建
+func (s *MemoryStore) post(msgBiz, msgMid, msgIdx string) (*model.Post, bool) {
+	key := postKey(msgBiz, msgMid, msgIdx)
+	p, ok := s.posts[key]
+	if !ok {
+		p = &model.Post{MsgBiz: msgBiz, MsgMid: msgMid, MsgIdx: msgIdx}
+		p.CreatedAt = time.Now()
+		s.posts[key] = p
+	}
+	return p, ok
+}
+
+func (s *MemoryStore) SaveProfile(_ context.Context, profile *model.Profile) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p := s.profile(profile.MsgBiz)
+	mergeString(&p.Title, profile.Title)
+	mergeString(&p.Headimg, profile.Headimg)
+	mergeString(&p.Username, profile.Username)
+	mergeString(&p.Desc, profile.Desc)
+	mergeTime(&p.OpenHistoryPageAt, profile.OpenHistoryPageAt)
+	mergeString(&p.CapturedBy, profile.CapturedBy)
+	p.UpdatedAt = time.Now()
+
+	saved := *p
+	s.record("SaveProfile", &saved)
+	return nil
+}
+
+func (s *MemoryStore) SavePosts(_ context.Context, posts []*model.Post) (SaveResult, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var (
+		saved  []*model.Post
+		result SaveResult
+	)
+	for _, post := range posts {
+		p, exists := s.post(post.MsgBiz, post.MsgMid, post.MsgIdx)
+		before := *p
+		mergeString(&p.Title, post.Title)
+		mergeString(&p.Link, post.Link)
+		mergeTime(&p.PublishAt, post.PublishAt)
+		mergeString(&p.Cover, post.Cover)
+		mergeString(&p.Digest, post.Digest)
+		mergeString(&p.SourceURL, post.SourceURL)
+		mergeString(&p.Author, post.Author)
+		if post.CopyrightStat != 0 {
+			p.CopyrightStat = post.CopyrightStat
+		}
+		mergeString(&p.CapturedBy, post.CapturedBy)
+
+		// 与 MongoDB 存储一致, 只有字段有变化时才更新 updatedAt
+		switch {
+		case !exists:
+			result.Inserted++
+			p.UpdatedAt = time.Now()
+		case reflect.DeepEqual(before, *p):
+			result.Unchanged++
+		default:
+			result.Updated++
+			p.UpdatedAt = time.Now()
+		}
+
+		cp := *p
+		saved = append(saved, &cp)
+	}
+
+	s.record("SavePosts", saved)
+	return result, nil
+}
+
+func (s *MemoryStore) SavePostDetail(_ context.Context, post *model.Post) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// 与 MongoDB 存储一致, 新值为空的字段保留原值, 阅读数和点赞数只增不减, 清除失效标记
+	p, _ := s.post(post.MsgBiz, post.MsgMid, post.MsgIdx)
+	mergeString(&p.Title, post.Title)
+	mergeString(&p.Link, post.Link)
+	mergeString(&p.RawLink, post.RawLink)
+	mergeTime(&p.PublishAt, post.PublishAt)
+	mergeString(&p.Cover, post.Cover)
+	mergeString(&p.Digest, post.Digest)
+	mergeString(&p.Content, post.Content)
+	mergeString(&p.HTML, post.HTML)
+	mergeString(&p.SourceURL, post.SourceURL)
+	mergeString(&p.Author, post.Author)
+	if post.CopyrightStat != 0 {
+		p.CopyrightStat = post.CopyrightStat
+	}
+	mergeString(&p.WechatId, post.WechatId)
+	mergeString(&p.Username, post.Username)
+	mergeString(&p.CapturedBy, post.CapturedBy)
+	p.ReadNum = max(p.ReadNum, post.ReadNum)
+	p.LikeNum = max(p.LikeNum, post.LikeNum)
+	p.IsFail = false
+	p.UpdatedAt = time.Now()
+
+	saved := *p
+	s.record("SavePostDetail", &saved)
+	return nil
+}
+
+func (s *MemoryStore) MarkPostInvalid(_ context.Context, msgBiz, msgMid, msgIdx, client string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p, _ := s.post(msgBiz, msgMid, msgIdx)
+	p.IsFail = true
+	p.CapturedBy = client
+	p.UpdatedAt = time.Now()
+
+	saved := *p
+	s.record("MarkPostInvalid", &saved)
+	return nil
+}
+
+func (s *MemoryStore) UpdateProfileFirstPublishAt(_ context.Context, msgBiz string, firstPublishAt time.Time) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p := s.profile(msgBiz)
+	p.FirstPublishAt = firstPublishAt
+	p.UpdatedAt = time.Now()
+
+	saved := *p
+	s.record("UpdateProfileFirstPublishAt", &saved)
+	return nil
+}
+
+func (s *MemoryStore) UpdateProfileLatestPublishAt(_ context.Context, msgBiz string, latestPublishAt time.Time) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// 与 MongoDB 存储一致, 公众号不存在时不创建
+	p, ok := s.profiles[msgBiz]
+	if !ok {
+		return nil
+	}
+	p.LatestPublishAt = latestPublishAt
+	p.UpdatedAt = time.Now()
+
+	saved := *p
+	s.record("UpdateProfileLatestPublishAt", &saved)
+	return nil
+}
+
+func (s *MemoryStore) UpsertDocument(_ context.Context, collection string, keys []string, doc map[string]interface{}) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var target map[string]interface{}
+	for _, d := range s.docs[collection] {
+		matched := true
+		for _, k := range keys {
+			if fmt.Sprint(d[k]) != fmt.Sprint(doc[k]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			target = d
+			break
+		}
+	}
+	if target == nil {
+		target = map[string]interface{}{}
+		s.docs[collection] = append(s.docs[collection], target)
+	}
+	for k, v := range doc {
+		target[k] = v
+	}
+
+	saved := make(map[string]interface{}, len(target)+1)
+	for k, v := range target {
+		saved[k] = v
+	}
+	saved["_collection"] = collection
+	s.record("UpsertDocument", saved)
+	return nil
+}
+
+func (s *MemoryStore) SaveDeadLetter(_ context.Context, post *model.Post, cause error, attempts int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := time.Now()
+	cp := *post
+	dl := &model.DeadLetter{
+		BaseModel: model.BaseModel{ID: primitive.NewObjectID(), CreatedAt: now, UpdatedAt: now},
+		Post:      &cp,
+		Error:     cause.Error(),
+		Attempts:  attempts,
+	}
+	s.dead = append(s.dead, dl)
+
+	saved := *dl
+	s.record("SaveDeadLetter", &saved)
+	return nil
+}
+
+func (s *MemoryStore) ListDeadLetters(_ context.Context, limit int) ([]*model.DeadLetter, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var list []*model.DeadLetter
+	for _, dl := range s.dead {
+		if limit > 0 && len(list) >= limit {
+			break
+		}
+		cp := *dl
+		post := *dl.Post
+		cp.Post = &post
+		list = append(list, &cp)
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) FindDeadLetters(_ context.Context, ids []primitive.ObjectID) ([]*model.DeadLetter, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	wanted := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var list []*model.DeadLetter
+	for _, dl := range s.dead {
+		if !wanted[dl.ID] {
+			continue
+		}
+		cp := *dl
+		post := *dl.Post
+		cp.Post = &post
+		list = append(list, &cp)
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) DeleteDeadLetter(_ context.Context, id primitive.ObjectID) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for i, dl := range s.dead {
+		if dl.ID == id {
+			s.dead = append(s.dead[:i], s.dead[i+1:]...)
+			s.record("DeleteDeadLetter", id.Hex())
+			break
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) PurgeDeadLetters(context.Context) (int64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	n := int64(len(s.dead))
+	s.dead = nil
+	s.record("PurgeDeadLetters", n)
+	return n, nil
+}
+
+func (s *MemoryStore) SaveShortLink(_ context.Context, link *model.ShortLink) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	l, ok := s.short[link.ShortID]
+	if !ok {
+		l = &model.ShortLink{ShortID: link.ShortID}
+		l.CreatedAt = time.Now()
+		s.short[link.ShortID] = l
+	}
+	l.MsgBiz = link.MsgBiz
+	l.MsgMid = link.MsgMid
+	l.MsgIdx = link.MsgIdx
+	l.UpdatedAt = time.Now()
+
+	saved := *l
+	s.record("SaveShortLink", &saved)
+	return nil
+}
+
+func (s *MemoryStore) FindShortLink(_ context.Context, shortID string) (*model.ShortLink, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	l, ok := s.short[shortID]
+	if !ok {
+		return nil, nil
+	}
+	cp := *l
+	return &cp, nil
+}
+
+// TakeWrites 返回并清空已记录的写入操作
+func (s *MemoryStore) TakeWrites() []StoreWrite {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	writes := s.writes
+	s.writes = nil
+	return writes
+}
+
+// Profiles 返回所有公众号资料, 按 msgBiz 排序
+func (s *MemoryStore) Profiles() []*model.Profile {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var list []*model.Profile
+	for _, p := range s.profiles {
+		cp := *p
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].MsgBiz < list[j].MsgBiz })
+	return list
+}
+
+// Documents 返回集合中的文档, 按写入顺序排列
+func (s *MemoryStore) Documents(collection string) []map[string]interface{} {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var list []map[string]interface{}
+	for _, d := range s.docs[collection] {
+		cp := make(map[string]interface{}, len(d))
+		for k, v := range d {
+			cp[k] = v
+		}
+		list = append(list, cp)
+	}
+	return list
+}
+
+// Posts 返回所有文章, 按 msgBiz/msgMid/msgIdx 排序
+func (s *MemoryStore) Posts() []*model.Post {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var list []*model.Post
+	for _, p := range s.posts {
+		cp := *p
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return postKey(list[i].MsgBiz, list[i].MsgMid, list[i].MsgIdx) <
+			postKey(list[j].MsgBiz, list[j].MsgMid, list[j].MsgIdx)
+	})
+	return list
+}
@@ -0,0 +1,86 @@
+package rules
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"wechat-backup/internal/model"
+)
+
+func TestMemoryStoreMergeRules(t *testing.T) {
+	store := NewMemoryStore()
+	publishAt := time.Unix(1703988000, 0)
+
+	require.NoError(t, store.SavePostDetail(context.Background(), &model.Post{
+		MsgBiz: "biz", MsgMid: "1", MsgIdx: "1",
+		Title: "标题", Content: "正文", HTML: "<p>正文</p>", Author: "作者",
+		PublishAt: publishAt, ReadNum: 100, LikeNum: 10,
+	}))
+
+	// 列表页没有正文, 摘要为空时不覆盖
+	result, err := store.SavePosts(context.Background(), []*model.Post{{
+		MsgBiz: "biz", MsgMid: "1", MsgIdx: "1",
+		Title: "新标题", Digest: "摘要",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{Updated: 1}, result)
+
+	// 再次抓取时正文解析失败、阅读数没有加载
+	require.NoError(t, store.SavePostDetail(context.Background(), &model.Post{
+		MsgBiz: "biz", MsgMid: "1", MsgIdx: "1",
+		ReadNum: 0, LikeNum: 12, CapturedBy: "phone2",
+	}))
+
+	posts := store.Posts()
+	require.Len(t, posts, 1)
+	p := posts[0]
+	assert.Equal(t, "新标题", p.Title)
+	assert.Equal(t, "摘要", p.Digest)
+	assert.Equal(t, "正文", p.Content)
+	assert.Equal(t, "<p>正文</p>", p.HTML)
+	assert.Equal(t, "作者", p.Author)
+	assert.True(t, publishAt.Equal(p.PublishAt))
+	assert.EqualValues(t, 100, p.ReadNum)
+	assert.EqualValues(t, 12, p.LikeNum)
+	assert.Equal(t, "phone2", p.CapturedBy)
+}
+
+func TestMemoryStoreSavePostsResult(t *testing.T) {
+	store := NewMemoryStore()
+	page := []*model.Post{
+		{MsgBiz: "biz", MsgMid: "1", MsgIdx: "1", Title: "第一篇"},
+		{MsgBiz: "biz", MsgMid: "1", MsgIdx: "2", Title: "第二篇"},
+	}
+
+	result, err := store.SavePosts(context.Background(), page)
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{Inserted: 2}, result)
+
+	// 再次滚动到同一页
+	result, err = store.SavePosts(context.Background(), page)
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{Unchanged: 2}, result)
+
+	result, err = store.SavePosts(context.Background(), []*model.Post{
+		{MsgBiz: "biz", MsgMid: "1", MsgIdx: "1", Title: "第一篇(修改)"},
+		{MsgBiz: "biz", MsgMid: "1", MsgIdx: "2", Title: "第二篇"},
+		{MsgBiz: "biz", MsgMid: "2", MsgIdx: "1", Title: "第三篇"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, SaveResult{Inserted: 1, Updated: 1, Unchanged: 1}, result)
+}
+
+func TestMemoryStoreSavePostDetailClearsInvalid(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	// 暂时无法访问的文章被标记失效, 之后抓取到完整内容时恢复
+	require.NoError(t, store.MarkPostInvalid(ctx, "biz", "1", "1", "phone1"))
+	require.True(t, store.Posts()[0].IsFail)
+
+	require.NoError(t, store.SavePostDetail(ctx, &model.Post{MsgBiz: "biz", MsgMid: "1", MsgIdx: "1", Title: "标题"}))
+	assert.False(t, store.Posts()[0].IsFail)
+}
@@ -0,0 +1,87 @@
+package rules
+
+import (
+	"context"
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/repository"
+)
+
+// mongoStore 基于 MongoDB 的存储, 读写通过 repository 完成
+type mongoStore struct {
+	repo *repository.Repository
+}
+
+// NewMongoStore 创建基于 MongoDB 的存储
+func NewMongoStore(repo *repository.Repository) Store {
+	return &mongoStore{repo: repo}
+}
+
+func (s *mongoStore) SaveProfile(ctx context.Context, profile *model.Profile) error {
+	return s.repo.Profiles.Upsert(ctx, profile)
+}
+
+func (s *mongoStore) SavePosts(ctx context.Context, posts []*model.Post) (SaveResult, error) {
+	return s.repo.Posts.SaveSummaries(ctx, posts)
+}
+
+func (s *mongoStore) SavePostDetail(ctx context.Context, post *model.Post) error {
+	if err := s.repo.Posts.SaveDetail(ctx, post); err != nil {
+		return err
+	}
+
+	log.Infof("保存文章 %s 成功", post.Title)
+	return nil
+}
+
+func (s *mongoStore) MarkPostInvalid(ctx context.Context, msgBiz, msgMid, msgIdx, client string) error {
+	key := repository.PostKey{MsgBiz: msgBiz, MsgMid: msgMid, MsgIdx: msgIdx}
+	return s.repo.Posts.MarkInvalid(ctx, key, client)
+}
+
+func (s *mongoStore) UpdateProfileFirstPublishAt(ctx context.Context, msgBiz string, firstPublishAt time.Time) error {
+	return s.repo.Profiles.SetFirstPublishAt(ctx, msgBiz, firstPublishAt)
+}
+
+func (s *mongoStore) UpdateProfileLatestPublishAt(ctx context.Context, msgBiz string, latestPublishAt time.Time) error {
+	return s.repo.Profiles.SetLatestPublishAt(ctx, msgBiz, latestPublishAt)
+}
+
+func (s *mongoStore) UpsertDocument(ctx context.Context, collection string, keys []string, doc map[string]interface{}) error {
+	return s.repo.UpsertDocument(ctx, collection, keys, doc)
+}
+
+func (s *mongoStore) SaveDeadLetter(ctx context.Context, post *model.Post, cause error, attempts int) error {
+	return s.repo.DeadLetters.Add(ctx, post, cause, attempts)
+}
+
+func (s *mongoStore) ListDeadLetters(ctx context.Context, limit int) ([]*model.DeadLetter, error) {
+	return s.repo.DeadLetters.List(ctx, int64(limit))
+}
+
+func (s *mongoStore) FindDeadLetters(ctx context.Context, ids []primitive.ObjectID) ([]*model.DeadLetter, error) {
+	return s.repo.DeadLetters.Find(ctx, ids)
+}
+
+func (s *mongoStore) DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	return s.repo.DeadLetters.Delete(ctx, id)
+}
+
+func (s *mongoStore) PurgeDeadLetters(ctx context.Context) (int64, error) {
+	return s.repo.DeadLetters.Purge(ctx)
+}
+
+func (s *mongoStore) SaveShortLink(ctx context.Context, link *model.ShortLink) error {
+	return s.repo.ShortLinks.Upsert(ctx, link)
+}
+
+func (s *mongoStore) FindShortLink(ctx context.Context, shortID string) (*model.ShortLink, error) {
+	link, err := s.repo.ShortLinks.FindByShortID(ctx, shortID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return link, err
+}
@@ -16,14 +16,16 @@ func NewNextLinkRule() *NextLinkRule {
 		BaseRule{
 			ruleType:   "next_link",
 			urlPattern: "/wx/profiles/next_link",
+			priority:   PriorityNextLink,
 		},
 	}
 }
 
-func (r *NextLinkRule) Handle(ctx *Context) error {
+// HandleRequest 由代理直接应答, 不再请求上游
+func (r *NextLinkRule) HandleRequest(ctx *Context) (Result, error) {
 	// 只处理GET请求
 	if ctx.Method != "GET" {
-		return nil
+		return Continue, nil
 	}
 
 	log.Debugf("==========>[next_link] 开始处理: %s", ctx.URL)
@@ -40,13 +42,14 @@ func (r *NextLinkRule) Handle(ctx *Context) error {
 
 	responseBody, err := json.Marshal(response)
 	if err != nil {
-		return errors.Wrap(err, "序列化响应内容")
+		return Continue, errors.Wrap(err, "序列化响应内容")
 	}
 
 	ctx.Body = responseBody
-	ctx.Headers["Content-Type"] = "application/json"
+	ctx.ContentType = "application/json"
+	ctx.Reply = true
 
-	return nil
+	return Stop, nil
 }
 
 // getNextProfileLink 获取下一个跳转链接
@@ -0,0 +1,549 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/queue"
+)
+
+// 队列已满时的背压策略
+const (
+	// BackpressureBlock 等待队列腾出位置, 超过 PushTimeout 后由规则直接保存
+	BackpressureBlock = "block"
+	// BackpressureDrop 丢弃文章
+	BackpressureDrop = "drop"
+	// BackpressureSpill 写入磁盘, 队列腾出位置后重新入队
+	BackpressureSpill = "spill"
+)
+
+const (
+	// 阻塞策略下重新尝试入队的间隔
+	blockRetryInterval = 50 * time.Millisecond
+	// 磁盘中的文章重新入队的间隔
+	spillInterval = time.Second
+	spillExt      = ".json"
+)
+
+var (
+	// errPoolStopped 协程池未启动
+	errPoolStopped = errors.New("文章处理协程池未启动")
+	// ErrArticleDropped 队列已满, 按 drop 策略丢弃了文章
+	ErrArticleDropped = errors.New("文章处理队列已满, 丢弃文章")
+)
+
+// PoolConfig 文章处理协程池配置
+type PoolConfig struct {
+	Workers      int           // 工作协程数
+	Backpressure string        // 队列已满时的策略: block, drop, spill
+	PushTimeout  time.Duration // block 策略下最长等待时间
+	SpillDir     string        // spill 策略下写入文章的目录
+	Retry        RetryPolicy   // 保存失败时的重试策略
+}
+
+// WorkerStats 单个工作协程的统计
+type WorkerStats struct {
+	ID         int       `json:"id"`
+	Busy       bool      `json:"busy"`       // 是否正在处理文章
+	Processed  uint64    `json:"processed"`  // 保存成功的文章数
+	Failed     uint64    `json:"failed"`     // 转入死信的文章数
+	Retries    uint64    `json:"retries"`    // 重试次数
+	LastActive time.Time `json:"lastActive"` // 最近一次处理完文章的时间
+}
+
+// PoolStats 协程池统计
+type PoolStats struct {
+	Running      bool          `json:"running"`
+	Backpressure string        `json:"backpressure"`
+	Submitted    uint64        `json:"submitted"` // 成功入队的文章数, 不含写入磁盘的
+	Dropped      uint64        `json:"dropped"`
+	Spilled      uint64        `json:"spilled"`
+	Workers      []WorkerStats `json:"workers"`
+}
+
+// Unpersisted 没有保存的文章
+type Unpersisted struct {
+	Title  string
+	Link   string
+	Reason string
+}
+
+// UnpersistedError 关闭协程池时仍有文章没有保存, 包括运行期间丢弃的文章
+type UnpersistedError struct {
+	Items []Unpersisted
+	// 等待超时等导致关闭不完整的原因
+	Err error
+}
+
+func (e *UnpersistedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d 篇文章未保存", len(e.Items))
+	if e.Err != nil {
+		fmt.Fprintf(&b, " (%v)", e.Err)
+	}
+	for _, item := range e.Items {
+		fmt.Fprintf(&b, "\n  [%s] %s: %s", item.Title, item.Link, item.Reason)
+	}
+	return b.String()
+}
+
+func (e *UnpersistedError) Unwrap() error {
+	return e.Err
+}
+
+func unpersisted(post *model.Post, reason string) Unpersisted {
+	return Unpersisted{Title: post.Title, Link: post.Link, Reason: reason}
+}
+
+type workerStats struct {
+	// 正在处理的文章
+	current    atomic.Pointer[model.Post]
+	busy       atomic.Bool
+	processed  atomic.Uint64
+	failed     atomic.Uint64
+	retries    atomic.Uint64
+	lastActive atomic.Int64
+}
+
+// ArticlePool 文章处理协程池: 规则把解析好的文章放入队列, 工作协程从队列中取出后保存.
+// 临时错误按重试策略重试, 重试后仍失败的文章转入死信, 之后确认任务;
+// 未确认的任务在下次启动时重新处理
+type ArticlePool struct {
+	store Store
+	q     queue.Queue
+	cfg   PoolConfig
+
+	// 关闭协程池时取消, 中断等待中的重试和阻塞中的入队
+	ctx    context.Context
+	cancel context.CancelFunc
+	// 读写数据库的上下文, 关闭超时时取消, 中断卡住的保存
+	saveCtx    context.Context
+	cancelSave context.CancelFunc
+	wg         sync.WaitGroup
+	// 磁盘中的文章重新入队的协程
+	spillWg  sync.WaitGroup
+	spillMu  sync.Mutex
+	spillSeq uint64
+
+	mtx     sync.RWMutex
+	running bool
+
+	// 运行期间丢弃或无法转入死信的文章, 关闭时报告
+	lostMu sync.Mutex
+	lost   []Unpersisted
+
+	workers   []*workerStats
+	submitted atomic.Uint64
+	dropped   atomic.Uint64
+	spilled   atomic.Uint64
+}
+
+// NewArticlePool 创建协程池, 需要调用 Start 启动
+func NewArticlePool(store Store, q queue.Queue, cfg PoolConfig) *ArticlePool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.Backpressure == "" {
+		cfg.Backpressure = BackpressureBlock
+	}
+	if cfg.PushTimeout <= 0 {
+		cfg.PushTimeout = 5 * time.Second
+	}
+
+	p := &ArticlePool{
+		store:   store,
+		q:       q,
+		cfg:     cfg,
+		workers: make([]*workerStats, cfg.Workers),
+	}
+	for i := range p.workers {
+		p.workers[i] = &workerStats{}
+	}
+	return p
+}
+
+// Start 启动工作协程. spill 策略下先创建目录, 上次写入磁盘的文章会重新入队
+func (p *ArticlePool) Start() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.running {
+		return nil
+	}
+
+	if p.cfg.Backpressure == BackpressureSpill {
+		if err := os.MkdirAll(p.cfg.SpillDir, 0o755); err != nil {
+			return errors.Wrapf(err, "创建文章溢出目录 %s 失败", p.cfg.SpillDir)
+		}
+	}
+
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.saveCtx, p.cancelSave = context.WithCancel(context.Background())
+
+	for i := range p.workers {
+		p.wg.Add(1)
+		go p.work(i)
+	}
+
+	if p.cfg.Backpressure == BackpressureSpill {
+		p.spillWg.Add(1)
+		go p.drainSpill()
+	}
+
+	p.running = true
+	log.Infof("文章处理协程池已启动，工作协程数: %d, 背压策略: %s", p.cfg.Workers, p.cfg.Backpressure)
+	return nil
+}
+
+// Shutdown 停止接收文章, 等待正在处理的文章完成. 有文章没有保存时返回 *UnpersistedError,
+// 列出运行期间丢弃的文章, 以及 ctx 超时时仍在处理或留在内存队列中的文章, 超时后中断仍在进行的保存.
+// 持久化队列和磁盘中未处理的文章会在下次启动时继续处理
+func (p *ArticlePool) Shutdown(ctx context.Context) error {
+	p.mtx.Lock()
+	if !p.running {
+		p.mtx.Unlock()
+		return nil
+	}
+	p.running = false
+	p.mtx.Unlock()
+
+	// 中断等待中的重试和入队, 先停止磁盘文章入队, 再关闭队列
+	p.cancel()
+	p.spillWg.Wait()
+	if err := p.q.Close(); err != nil {
+		log.Warnf("关闭文章处理队列失败: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	var timeoutErr error
+	select {
+	case <-done:
+		log.Info("所有文章处理任务已完成")
+	case <-ctx.Done():
+		timeoutErr = errors.Wrap(ctx.Err(), "等待文章处理任务超时")
+	}
+
+	p.lostMu.Lock()
+	items := append([]Unpersisted(nil), p.lost...)
+	p.lostMu.Unlock()
+
+	if timeoutErr != nil {
+		items = append(items, p.abandoned()...)
+	}
+	// 列出仍在处理的文章后再中断卡住的保存, 中断后的文章不会重复列出
+	p.cancelSave()
+	if n := p.spillPending(); n > 0 {
+		log.Infof("%d 篇文章保存在溢出目录 %s, 下次启动时重新入队", n, p.cfg.SpillDir)
+	}
+
+	if len(items) == 0 && timeoutErr == nil {
+		return nil
+	}
+	return &UnpersistedError{Items: items, Err: timeoutErr}
+}
+
+// abandoned 超时后仍在处理的文章, 以及内存队列中还没有取出的文章
+func (p *ArticlePool) abandoned() []Unpersisted {
+	drainer, volatile := p.q.(queue.Drainer)
+
+	var items []Unpersisted
+	for _, w := range p.workers {
+		if post := w.current.Load(); post != nil {
+			reason := "关闭超时时仍在处理, 未确认的任务下次启动时重新处理"
+			if volatile {
+				reason = "关闭超时时仍在处理, 内存队列不会重新处理"
+			}
+			items = append(items, unpersisted(post, reason))
+		}
+	}
+
+	if volatile {
+		for _, msg := range drainer.Drain() {
+			var post model.Post
+			if err := json.Unmarshal(msg.Payload, &post); err != nil {
+				post.Title = "任务 " + msg.ID
+			}
+			items = append(items, unpersisted(&post, "关闭超时时仍在内存队列中"))
+		}
+	}
+	return items
+}
+
+// spillPending 溢出目录中等待入队的文章数
+func (p *ArticlePool) spillPending() int {
+	if p.cfg.Backpressure != BackpressureSpill {
+		return 0
+	}
+	matches, _ := filepath.Glob(filepath.Join(p.cfg.SpillDir, "*"+spillExt))
+	return len(matches)
+}
+
+func (p *ArticlePool) addLost(item Unpersisted) {
+	p.lostMu.Lock()
+	defer p.lostMu.Unlock()
+
+	p.lost = append(p.lost, item)
+}
+
+// Submit 将文章放入处理队列. 队列已满时按背压策略处理:
+// block 超时后返回错误, drop 返回 ErrArticleDropped, spill 写入磁盘.
+// 协程池未启动时返回 errPoolStopped
+func (p *ArticlePool) Submit(post *model.Post) error {
+	if p == nil {
+		return errPoolStopped
+	}
+
+	// 只在检查状态时持有锁, 入队可能等待 PushTimeout, 持有锁会阻塞 Shutdown 和 Stats
+	p.mtx.RLock()
+	running := p.running
+	p.mtx.RUnlock()
+	if !running {
+		return errPoolStopped
+	}
+
+	payload, err := json.Marshal(post)
+	if err != nil {
+		return errors.Wrap(err, "序列化文章失败")
+	}
+
+	switch p.cfg.Backpressure {
+	case BackpressureDrop:
+		err = p.push(payload)
+		if errors.Is(err, queue.ErrFull) {
+			p.dropped.Add(1)
+			p.addLost(unpersisted(post, "队列已满, 按 drop 策略丢弃"))
+			return ErrArticleDropped
+		}
+	case BackpressureSpill:
+		err = p.push(payload)
+		if errors.Is(err, queue.ErrFull) {
+			if err := p.spill(payload); err != nil {
+				return err
+			}
+			p.spilled.Add(1)
+			return nil
+		}
+	default:
+		err = p.pushWait(payload)
+	}
+
+	if err != nil {
+		// 入队期间协程池已关闭, 由调用方直接保存
+		if p.ctx.Err() != nil || errors.Is(err, queue.ErrClosed) {
+			return errPoolStopped
+		}
+		return err
+	}
+	p.submitted.Add(1)
+	return nil
+}
+
+// Stats 返回协程池和各工作协程的统计
+func (p *ArticlePool) Stats() PoolStats {
+	p.mtx.RLock()
+	running := p.running
+	p.mtx.RUnlock()
+
+	stats := PoolStats{
+		Running:      running,
+		Backpressure: p.cfg.Backpressure,
+		Submitted:    p.submitted.Load(),
+		Dropped:      p.dropped.Load(),
+		Spilled:      p.spilled.Load(),
+		Workers:      make([]WorkerStats, len(p.workers)),
+	}
+	for i, w := range p.workers {
+		ws := WorkerStats{
+			ID:        i,
+			Busy:      w.busy.Load(),
+			Processed: w.processed.Load(),
+			Failed:    w.failed.Load(),
+			Retries:   w.retries.Load(),
+		}
+		if t := w.lastActive.Load(); t > 0 {
+			ws.LastActive = time.Unix(0, t)
+		}
+		stats.Workers[i] = ws
+	}
+	return stats
+}
+
+// push 尝试入队一次
+func (p *ArticlePool) push(payload []byte) error {
+	ctx, cancel := context.WithTimeout(p.ctx, 5*time.Second)
+	defer cancel()
+	return p.q.Push(ctx, payload)
+}
+
+// pushWait 队列已满时等待, 最多等待 PushTimeout, 协程池关闭时立即返回
+func (p *ArticlePool) pushWait(payload []byte) error {
+	ctx, cancel := context.WithTimeout(p.ctx, p.cfg.PushTimeout)
+	defer cancel()
+
+	for {
+		err := p.q.Push(ctx, payload)
+		if !errors.Is(err, queue.ErrFull) {
+			return err
+		}
+
+		select {
+		case <-time.After(blockRetryInterval):
+		case <-ctx.Done():
+			return errors.Wrapf(err, "等待 %v 后", p.cfg.PushTimeout)
+		}
+	}
+}
+
+// work 工作协程, 队列关闭且取完后退出
+func (p *ArticlePool) work(workerID int) {
+	defer p.wg.Done()
+	for {
+		msg, err := p.q.Pop(context.Background())
+		if errors.Is(err, queue.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Errorf("工作协程 #%d 读取队列失败: %v", workerID, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		w := p.workers[workerID]
+		w.busy.Store(true)
+		p.process(workerID, msg)
+		w.current.Store(nil)
+		w.busy.Store(false)
+		w.lastActive.Store(time.Now().UnixNano())
+	}
+}
+
+// process 保存队列中的文章, 保存成功或转入死信后确认
+func (p *ArticlePool) process(workerID int, msg *queue.Message) {
+	w := p.workers[workerID]
+
+	var post model.Post
+	if err := json.Unmarshal(msg.Payload, &post); err != nil {
+		// 无法解析的任务重试也不会成功, 直接确认丢弃
+		log.Errorf("工作协程 #%d 解析任务 %s 失败, 丢弃: %v", workerID, msg.ID, err)
+		w.failed.Add(1)
+	} else {
+		w.current.Store(&post)
+		attempts, err := p.cfg.Retry.Do(p.ctx, func() error {
+			return savePostDetail(p.saveCtx, p.store, &post)
+		})
+		w.retries.Add(uint64(attempts - 1))
+		// 关闭协程池时中断重试, 同样转入死信, 内存队列中的文章也不会丢失
+		if err != nil {
+			log.Errorf("工作协程 #%d 保存文章 [%s] 失败 %d 次, 转入死信: %v", workerID, post.Title, attempts, err)
+			if dlErr := p.store.SaveDeadLetter(p.saveCtx, &post, err, attempts); dlErr != nil {
+				log.Errorf("工作协程 #%d 保存死信失败, 下次启动时重试: %v", workerID, dlErr)
+				reason := fmt.Sprintf("保存失败且无法转入死信: %v", err)
+				if _, volatile := p.q.(queue.Drainer); volatile {
+					reason = fmt.Sprintf("保存失败且无法转入死信, 内存队列不会重新处理: %v", err)
+				}
+				p.addLost(unpersisted(&post, reason))
+				return
+			}
+			w.failed.Add(1)
+		} else {
+			w.processed.Add(1)
+		}
+	}
+
+	ackCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.q.Ack(ackCtx, msg); err != nil {
+		log.Errorf("工作协程 #%d 确认任务失败: %v", workerID, err)
+	}
+}
+
+// spill 将文章写入磁盘, 先写临时文件再重命名, 重新入队时不会读到写了一半的文件
+func (p *ArticlePool) spill(payload []byte) error {
+	p.spillMu.Lock()
+	p.spillSeq++
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), p.spillSeq, spillExt)
+	p.spillMu.Unlock()
+
+	path := filepath.Join(p.cfg.SpillDir, name)
+	if err := os.WriteFile(path+".tmp", payload, 0o644); err != nil {
+		return errors.Wrap(err, "写入溢出文章失败")
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return errors.Wrap(err, "写入溢出文章失败")
+	}
+	return nil
+}
+
+// drainSpill 定期将磁盘中的文章按写入顺序重新入队, 队列再次写满时等待下一轮
+func (p *ArticlePool) drainSpill() {
+	defer p.spillWg.Done()
+
+	ticker := time.NewTicker(spillInterval)
+	defer ticker.Stop()
+
+	for {
+		p.requeueSpilled()
+
+		select {
+		case <-ticker.C:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *ArticlePool) requeueSpilled() {
+	entries, err := os.ReadDir(p.cfg.SpillDir)
+	if err != nil {
+		log.Warnf("读取文章溢出目录失败: %v", err)
+		return
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spillExt) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(p.cfg.SpillDir, name)
+		payload, err := os.ReadFile(path)
+		if err != nil {
+			log.Warnf("读取溢出文章 %s 失败: %v", name, err)
+			continue
+		}
+
+		err = p.push(payload)
+		if errors.Is(err, queue.ErrFull) || errors.Is(err, queue.ErrClosed) || p.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warnf("溢出文章 %s 重新入队失败: %v", name, err)
+			return
+		}
+
+		p.submitted.Add(1)
+		if err := os.Remove(path); err != nil {
+			// 文章会在下次重新入队, 重复保存是幂等的
+			log.Warnf("删除溢出文章 %s 失败: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/queue"
+)
+
+// gatedStore 保存文章前等待 gate 关闭, 像卡住的数据库一样只响应 ctx 取消
+type gatedStore struct {
+	*MemoryStore
+	gate chan struct{}
+}
+
+func (s *gatedStore) SavePostDetail(ctx context.Context, post *model.Post) error {
+	select {
+	case <-s.gate:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.MemoryStore.SavePostDetail(ctx, post)
+}
+
+func testPost(i int) *model.Post {
+	return &model.Post{MsgBiz: "biz", MsgMid: strconv.Itoa(i), MsgIdx: "1", Title: "标题" + strconv.Itoa(i)}
+}
+
+// fillPool 让唯一的工作协程阻塞在第一篇文章上, 第二篇文章占满容量为 1 的队列
+func fillPool(t *testing.T, cfg PoolConfig) (*ArticlePool, *gatedStore) {
+	store := &gatedStore{MemoryStore: NewMemoryStore(), gate: make(chan struct{})}
+	cfg.Workers = 1
+	pool := NewArticlePool(store, queue.NewMemory(1), cfg)
+	require.NoError(t, pool.Start())
+	t.Cleanup(func() { _ = pool.Shutdown(context.Background()) })
+
+	require.NoError(t, pool.Submit(testPost(1)))
+	require.Eventually(t, func() bool { return pool.Stats().Workers[0].Busy }, time.Second, time.Millisecond)
+	require.NoError(t, pool.Submit(testPost(2)))
+	return pool, store
+}
+
+func TestArticlePoolBackpressure(t *testing.T) {
+	t.Run("block", func(t *testing.T) {
+		pool, store := fillPool(t, PoolConfig{Backpressure: BackpressureBlock, PushTimeout: 50 * time.Millisecond})
+
+		err := pool.Submit(testPost(3))
+		assert.ErrorIs(t, err, queue.ErrFull)
+
+		// 等待期间队列腾出位置
+		time.AfterFunc(20*time.Millisecond, func() { close(store.gate) })
+		pool.cfg.PushTimeout = time.Second
+		require.NoError(t, pool.Submit(testPost(3)))
+
+		require.NoError(t, pool.Shutdown(context.Background()))
+		assert.Len(t, store.Posts(), 3)
+		assert.EqualValues(t, 3, pool.Stats().Submitted)
+	})
+
+	t.Run("block interrupted by shutdown", func(t *testing.T) {
+		pool, _ := fillPool(t, PoolConfig{Backpressure: BackpressureBlock, PushTimeout: time.Minute})
+
+		submitted := make(chan error, 1)
+		go func() { submitted <- pool.Submit(testPost(3)) }()
+		time.Sleep(20 * time.Millisecond)
+
+		// 等待入队时不阻塞统计
+		stats := make(chan PoolStats, 1)
+		go func() { stats <- pool.Stats() }()
+		select {
+		case <-stats:
+		case <-time.After(time.Second):
+			t.Fatal("Stats 被等待入队的 Submit 阻塞")
+		}
+
+		// 关闭时中断等待, 不等到 PushTimeout
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_ = pool.Shutdown(ctx)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		select {
+		case err := <-submitted:
+			assert.ErrorIs(t, err, errPoolStopped)
+		case <-time.After(time.Second):
+			t.Fatal("关闭后 Submit 仍在等待")
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		pool, store := fillPool(t, PoolConfig{Backpressure: BackpressureDrop})
+
+		assert.ErrorIs(t, pool.Submit(testPost(3)), ErrArticleDropped)
+		close(store.gate)
+
+		// 关闭时报告丢弃的文章
+		var unpersisted *UnpersistedError
+		require.ErrorAs(t, pool.Shutdown(context.Background()), &unpersisted)
+		assert.NoError(t, unpersisted.Err)
+		require.Len(t, unpersisted.Items, 1)
+		assert.Equal(t, "标题3", unpersisted.Items[0].Title)
+		assert.Len(t, store.Posts(), 2)
+		stats := pool.Stats()
+		assert.EqualValues(t, 2, stats.Submitted)
+		assert.EqualValues(t, 1, stats.Dropped)
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		dir := t.TempDir()
+		pool, store := fillPool(t, PoolConfig{Backpressure: BackpressureSpill, SpillDir: dir})
+
+		require.NoError(t, pool.Submit(testPost(3)))
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		assert.Len(t, files, 1)
+		assert.EqualValues(t, 1, pool.Stats().Spilled)
+
+		// 队列腾出位置后重新入队
+		close(store.gate)
+		require.Eventually(t, func() bool { return len(store.Posts()) == 3 }, 5*time.Second, 10*time.Millisecond)
+		files, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+		assert.Empty(t, files)
+	})
+}
+
+func TestArticlePoolShutdownTimeout(t *testing.T) {
+	store := &gatedStore{MemoryStore: NewMemoryStore(), gate: make(chan struct{})}
+	defer close(store.gate)
+	pool := NewArticlePool(store, queue.NewMemory(10), PoolConfig{Workers: 1})
+	require.NoError(t, pool.Start())
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, pool.Submit(testPost(i)))
+	}
+	require.Eventually(t, func() bool { return pool.Stats().Workers[0].Busy }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := pool.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// 报告仍在处理和留在内存队列中的文章
+	var unpersisted *UnpersistedError
+	require.ErrorAs(t, err, &unpersisted)
+	var titles []string
+	for _, item := range unpersisted.Items {
+		titles = append(titles, item.Title)
+	}
+	assert.Equal(t, []string{"标题1", "标题2", "标题3"}, titles)
+	assert.Contains(t, err.Error(), "3 篇文章未保存")
+
+	// 超时后中断卡住的保存, 工作协程退出
+	assert.Eventually(t, func() bool { return !pool.Stats().Workers[0].Busy }, time.Second, time.Millisecond)
+}
+
+func TestArticlePoolSpillRecoveredOnStart(t *testing.T) {
+	dir := t.TempDir()
+	payload, err := json.Marshal(testPost(1))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000001-000001.json"), payload, 0o644))
+	// 写了一半的临时文件不会入队
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000002-000002.json.tmp"), []byte("{"), 0o644))
+
+	store := NewMemoryStore()
+	pool := NewArticlePool(store, queue.NewMemory(10), PoolConfig{Workers: 1, Backpressure: BackpressureSpill, SpillDir: dir})
+	require.NoError(t, pool.Start())
+
+	require.Eventually(t, func() bool { return len(store.Posts()) == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, pool.Shutdown(context.Background()))
+	assert.Equal(t, "标题1", store.Posts()[0].Title)
+}
+
+func TestArticlePoolStats(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), failures: 1, err: transientErr}
+	pool := NewArticlePool(store, queue.NewMemory(10), PoolConfig{
+		Workers: 3,
+		Retry:   RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	})
+	assert.False(t, pool.Stats().Running)
+	require.NoError(t, pool.Start())
+	assert.True(t, pool.Stats().Running)
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, pool.Submit(testPost(i)))
+	}
+	// 关闭时会中断重试, 等待全部保存后再关闭
+	require.Eventually(t, func() bool { return len(store.Posts()) == 5 }, time.Second, time.Millisecond)
+	require.NoError(t, pool.Shutdown(context.Background()))
+
+	stats := pool.Stats()
+	assert.False(t, stats.Running)
+	assert.Equal(t, BackpressureBlock, stats.Backpressure)
+	assert.EqualValues(t, 5, stats.Submitted)
+	require.Len(t, stats.Workers, 3)
+
+	var processed, retries uint64
+	for i, w := range stats.Workers {
+		assert.Equal(t, i, w.ID)
+		assert.False(t, w.Busy)
+		processed += w.Processed
+		retries += w.Retries
+		if w.Processed > 0 {
+			assert.False(t, w.LastActive.IsZero())
+		}
+	}
+	assert.EqualValues(t, 5, processed)
+	assert.EqualValues(t, 1, retries)
+
+	// 关闭后同步保存
+	assert.ErrorIs(t, pool.Submit(testPost(6)), errPoolStopped)
+}
@@ -7,15 +7,13 @@ import (
 	"fmt"
 	"github.com/marmotedu/errors"
 	"github.com/marmotedu/log"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/url"
 	"strings"
 	"time"
 	"wechat-backup/internal/model"
-	"wechat-backup/internal/pkg/mongo"
 	"wechat-backup/internal/pkg/util/html"
 	"wechat-backup/internal/pkg/util/regex"
+	"wechat-backup/internal/pkg/wxlink"
 )
 
 //go:embed insertProfileScript.html
@@ -26,19 +24,21 @@ type ProfileRule struct {
 	BaseRule
 }
 
-func NewProfileRule() *ProfileRule {
+func NewProfileRule(store Store) *ProfileRule {
 	return &ProfileRule{
 		BaseRule{
 			ruleType:   RuleTypeProfile,
 			urlPattern: "/mp/profile_ext?action=home",
+			store:      store,
+			priority:   PriorityProfile,
 		},
 	}
 }
 
-func (r *ProfileRule) Handle(ctx *Context) error {
-	err := handleBasicInfoAndPostList(ctx)
+func (r *ProfileRule) HandleResponse(ctx *Context) (Result, error) {
+	err := r.handleBasicInfoAndPostList(ctx)
 	if err != nil {
-		return err
+		return Continue, err
 	}
 
 	content := string(ctx.Body)
@@ -47,7 +47,7 @@ func (r *ProfileRule) Handle(ctx *Context) error {
 	if strings.Contains(content, "此帐号已申请帐号迁移") ||
 		strings.Contains(content, "已停止访问该网页") ||
 		strings.Contains(content, "此账号已自主注销") {
-		return handleInvalidAccount(content)
+		return Continue, handleInvalidAccount(content)
 	}
 
 	// 获取跳转间隔和最小时间配置
@@ -66,19 +66,20 @@ func (r *ProfileRule) Handle(ctx *Context) error {
 	// 更新响应内容
 	ctx.Body = []byte(content)
 
-	return nil
+	return Continue, nil
 }
 
-func handleBasicInfoAndPostList(ctx *Context) error {
+func (r *ProfileRule) handleBasicInfoAndPostList(ctx *Context) error {
 	content := string(ctx.Body)
 	// 解析公众号资料
 	profile, err := parseProfile(content)
 	if err != nil {
 		return err
 	}
+	profile.CapturedBy = ctx.Client
 
 	// 保存到数据库
-	if err = saveProfile(profile); err != nil {
+	if err = r.store.SaveProfile(ctx.Context(), profile); err != nil {
 		return err
 	}
 
@@ -111,6 +112,7 @@ func handleBasicInfoAndPostList(ctx *Context) error {
 		if item.AppMsgExtInfo.Title != "" && item.AppMsgExtInfo.ContentURL != "" {
 			post := buildPost(item.AppMsgExtInfo, publishAt)
 			if post != nil {
+				post.CapturedBy = ctx.Client
 				posts = append(posts, post)
 			}
 		}
@@ -119,6 +121,7 @@ func handleBasicInfoAndPostList(ctx *Context) error {
 			if multiItem.Title != "" && multiItem.ContentURL != "" {
 				post := buildPost(multiItem, publishAt)
 				if post != nil {
+					post.CapturedBy = ctx.Client
 					posts = append(posts, post)
 				}
 			}
@@ -126,13 +129,16 @@ func handleBasicInfoAndPostList(ctx *Context) error {
 	}
 
 	// 保存文章到数据库
-	if err := savePostsToDB(posts); err != nil {
+	result, err := savePosts(ctx.Context(), r.store, posts)
+	// 无序写入时部分文章可能已经保存, 失败时同样输出汇总
+	logSaveResult("历史页", posts, result)
+	if err != nil {
 		return err
 	}
 
 	// 更新公众号最新发布时间
 
-	return updateProfileLatestPublishAt(posts)
+	return updateProfileLatestPublishAt(ctx.Context(), r.store, posts)
 }
 
 func parseProfile(content string) (*model.Profile, error) {
@@ -154,32 +160,6 @@ func parseProfile(content string) (*model.Profile, error) {
 	}, nil
 }
 
-func saveProfile(profile *model.Profile) error {
-	db := mongo.GetMongoDB()
-	collection := db.Collection("profiles")
-
-	filter := bson.M{"msgBiz": profile.MsgBiz}
-	update := bson.M{
-		"$set": bson.M{
-			"title":             profile.Title,
-			"headimg":           profile.Headimg,
-			"username":          profile.Username,
-			"desc":              profile.Desc,
-			"openHistoryPageAt": profile.OpenHistoryPageAt,
-			"updatedAt":         profile.UpdatedAt,
-		},
-		// 只在首次插入时设置创建时间
-		"$setOnInsert": bson.M{
-			"createdAt":      time.Now(),
-			"maxDayPubCount": 0,
-		},
-	}
-	opts := options.Update().SetUpsert(true)
-
-	_, err := collection.UpdateOne(context.Background(), filter, update, opts)
-	return errors.Wrap(err, "保存公众号资料失败")
-}
-
 func handleInvalidAccount(body string) error {
 	// TODO: 处理无效账号的逻辑
 	return nil
@@ -251,7 +231,7 @@ func buildPost(info interface{}, publishAt time.Time) *model.Post {
 		MsgMid:        msgMid,
 		MsgIdx:        msgIdx,
 		Title:         title,
-		Link:          contentURL,
+		Link:          wxlink.Canonical(contentURL),
 		PublishAt:     publishAt,
 		Cover:         cover,
 		Digest:        digest,
@@ -261,65 +241,40 @@ func buildPost(info interface{}, publishAt time.Time) *model.Post {
 	}
 }
 
-// savePostsToDB 保存文章到数据库
-func savePostsToDB(posts []*model.Post) error {
-	db := mongo.GetMongoDB()
-	collection := db.Collection("posts")
+// savePosts 批量保存一页文章到数据库
+func savePosts(ctx context.Context, store Store, posts []*model.Post) (SaveResult, error) {
+	result, err := store.SavePosts(ctx, posts)
+	if err != nil {
+		return result, err
+	}
 
 	for _, post := range posts {
-		filter := bson.M{
-			"msgBiz": post.MsgBiz,
-			"msgMid": post.MsgMid,
-			"msgIdx": post.MsgIdx,
-		}
-
-		update := bson.M{
-			"$set": bson.M{
-				"title":         post.Title,
-				"link":          post.Link,
-				"publishAt":     post.PublishAt,
-				"cover":         post.Cover,
-				"digest":        post.Digest,
-				"sourceUrl":     post.SourceURL,
-				"author":        post.Author,
-				"copyrightStat": post.CopyrightStat,
-				"updatedAt":     time.Now(),
-			},
-			"$setOnInsert": bson.M{
-				"createdAt": time.Now(),
-			},
-		}
-
-		opts := options.Update().SetUpsert(true)
-		_, err := collection.UpdateOne(context.Background(), filter, update, opts)
-		if err != nil {
-			return errors.Wrap(err, "保存文章失败")
+		publishTime := ""
+		if !post.PublishAt.IsZero() {
+			publishTime = post.PublishAt.Format("2006-01-02 15:04")
 		}
+		log.Debugf("[保存历史文章] 发布时间: %s, 标题: %s", publishTime, post.Title)
 	}
 
-	// 打印日志
-	if len(posts) > 0 {
-		profileCollection := db.Collection("profiles")
-		var profile model.Profile
-		err := profileCollection.FindOne(context.Background(), bson.M{"msgBiz": posts[0].MsgBiz}).Decode(&profile)
-		if err == nil && profile.Title != "" {
-			log.Infof("[profile] msgBiz: %s, title: %s", posts[0].MsgBiz, profile.Title)
-		}
+	return result, nil
+}
 
-		for _, post := range posts {
-			publishTime := ""
-			if !post.PublishAt.IsZero() {
-				publishTime = post.PublishAt.Format("2006-01-02 15:04")
-			}
-			log.Infof("[保存历史文章] 发布时间: %s, 标题: %s", publishTime, post.Title)
-		}
+// logSaveResult 每页文章保存后输出一行汇总
+func logSaveResult(page string, posts []*model.Post, result SaveResult) {
+	if len(posts) == 0 {
+		return
 	}
-
-	return nil
+	if result.Failed > 0 {
+		log.Warnf("[保存历史文章] %s %s: 共 %d 篇, 新增 %d, 更新 %d, 未变化 %d, 失败 %d",
+			posts[0].MsgBiz, page, len(posts), result.Inserted, result.Updated, result.Unchanged, result.Failed)
+		return
+	}
+	log.Infof("[保存历史文章] %s %s: 共 %d 篇, 新增 %d, 更新 %d, 未变化 %d",
+		posts[0].MsgBiz, page, len(posts), result.Inserted, result.Updated, result.Unchanged)
 }
 
 // updateProfileLatestPublishAt 更新公众号最新发布时间
-func updateProfileLatestPublishAt(posts []*model.Post) error {
+func updateProfileLatestPublishAt(ctx context.Context, store Store, posts []*model.Post) error {
 	if len(posts) == 0 {
 		return nil
 	}
@@ -332,17 +287,5 @@ func updateProfileLatestPublishAt(posts []*model.Post) error {
 		}
 	}
 
-	db := mongo.GetMongoDB()
-	collection := db.Collection("profiles")
-
-	filter := bson.M{"msgBiz": posts[0].MsgBiz}
-	update := bson.M{
-		"$set": bson.M{
-			"latestPublishAt": latestTime,
-			"updatedAt":       time.Now(),
-		},
-	}
-
-	_, err := collection.UpdateOne(context.Background(), filter, update)
-	return errors.Wrap(err, "更新公众号最新发布时间失败")
+	return store.UpdateProfileLatestPublishAt(ctx, posts[0].MsgBiz, latestTime)
 }
@@ -0,0 +1,70 @@
+package rules
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/marmotedu/errors"
+	driver "go.mongodb.org/mongo-driver/mongo"
+)
+
+// RetryPolicy 保存文章失败时的重试策略, 只重试临时错误, 等待时间按指数增长
+type RetryPolicy struct {
+	MaxRetries     int           // 最多重试次数, 不含第一次
+	InitialBackoff time.Duration // 第一次重试前的等待时间
+	MaxBackoff     time.Duration // 等待时间上限
+}
+
+// Backoff 返回第 n 次重试(从 1 开始)前的等待时间
+func (p RetryPolicy) Backoff(n int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// Do 执行 fn, 临时错误按退避时间重试. 返回尝试的次数和最后一次的错误, ctx 取消时停止重试
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) (int, error) {
+	attempts := 0
+	for {
+		attempts++
+		err := fn()
+		if err == nil || !IsTransient(err) || attempts > p.MaxRetries {
+			return attempts, err
+		}
+
+		timer := time.NewTimer(p.Backoff(attempts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, err
+		}
+	}
+}
+
+// IsTransient 判断是否为可以重试的临时错误: 网络错误、超时, 以及 MongoDB 标记为可重试的错误
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// 超时包括选择服务器超时, 如选主期间
+	if driver.IsNetworkError(err) || driver.IsTimeout(err) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var labeled driver.LabeledError
+	return errors.As(err, &labeled) &&
+		(labeled.HasErrorLabel("RetryableWriteError") || labeled.HasErrorLabel("TransientTransactionError"))
+}
@@ -0,0 +1,98 @@
+package rules
+
+import (
+	"context"
+	"github.com/marmotedu/log"
+	"net/url"
+	"regexp"
+	"strings"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/util/html"
+)
+
+// shortLinkPattern 短链接 mp.weixin.qq.com/s/<22位ID>, 支持可选的:443端口
+var shortLinkPattern = regexp.MustCompile(`mp\.weixin\.qq\.com(:\d+)?/s/([\w-]{22})`)
+
+// 文章页面中的标识变量, 形如 var biz = "" || "MzA5...";
+var (
+	pageBizPattern  = regexp.MustCompile(`var biz = "([^"]*)"(?:\s*\|\|\s*"([^"]*)")?`)
+	pageMidPattern  = regexp.MustCompile(`var mid = "([^"]*)"(?:\s*\|\|\s*"([^"]*)")?`)
+	pageIdxPattern  = regexp.MustCompile(`var idx = "([^"]*)"(?:\s*\|\|\s*"([^"]*)")?`)
+	pageLinkPattern = regexp.MustCompile(`var msg_link = "([^"]*)"`)
+)
+
+// shortLinkID 返回短链接中的 ID, 不是短链接时返回空
+func shortLinkID(link string) string {
+	if matches := shortLinkPattern.FindStringSubmatch(link); len(matches) > 2 {
+		return matches[2]
+	}
+	return ""
+}
+
+// pageVar 返回页面变量的值, 取 `"a" || "b"` 中第一个非空的值
+func pageVar(re *regexp.Regexp, content string) string {
+	for _, v := range re.FindStringSubmatch(content)[1:] {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parsePageKey 从页面变量中读取文章的规范标识和链接. 变量缺失时从 msg_link 的参数中读取
+func parsePageKey(content string) (msgBiz, msgMid, msgIdx, link string) {
+	if pageBizPattern.MatchString(content) {
+		msgBiz = pageVar(pageBizPattern, content)
+	}
+	if pageMidPattern.MatchString(content) {
+		msgMid = pageVar(pageMidPattern, content)
+	}
+	if pageIdxPattern.MatchString(content) {
+		msgIdx = pageVar(pageIdxPattern, content)
+	}
+
+	matches := pageLinkPattern.FindStringSubmatch(content)
+	if len(matches) < 2 || matches[1] == "" {
+		return
+	}
+	link = html.UnescapeHTML(matches[1])
+	u, err := url.Parse(link)
+	if err != nil {
+		return msgBiz, msgMid, msgIdx, ""
+	}
+	query := u.Query()
+	if msgBiz == "" {
+		msgBiz = query.Get("__biz")
+	}
+	if msgMid == "" {
+		msgMid = query.Get("mid")
+	}
+	if msgIdx == "" {
+		msgIdx = query.Get("idx")
+	}
+	// #rd 只用于微信客户端内跳转
+	link = strings.TrimSuffix(link, "#rd")
+	return
+}
+
+// resolveShortLink 页面中有文章标识时记录短链接对应的文章, 否则用已记录的映射补全标识.
+// 通过历史列表找到的同一篇文章使用相同的标识保存, 不会产生重复文档
+func resolveShortLink(ctx context.Context, store Store, shortID string, post *model.Post) {
+	if post.MsgBiz != "" && post.MsgMid != "" && post.MsgIdx != "" {
+		err := store.SaveShortLink(ctx, &model.ShortLink{ShortID: shortID, MsgBiz: post.MsgBiz, MsgMid: post.MsgMid, MsgIdx: post.MsgIdx})
+		if err != nil {
+			log.Warnf("保存短链接 %s 失败: %v", shortID, err)
+		}
+		return
+	}
+
+	link, err := store.FindShortLink(ctx, shortID)
+	if err != nil {
+		log.Warnf("查询短链接 %s 失败: %v", shortID, err)
+		return
+	}
+	if link == nil {
+		return
+	}
+	post.MsgBiz, post.MsgMid, post.MsgIdx = link.MsgBiz, link.MsgMid, link.MsgIdx
+}
@@ -0,0 +1,57 @@
+package rules
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/repository"
+)
+
+// SaveResult 批量保存的结果
+type SaveResult = repository.SaveResult
+
+// Store 规则使用的持久化接口
+type Store interface {
+	// SaveProfile 保存公众号资料
+	SaveProfile(ctx context.Context, profile *model.Profile) error
+
+	// SavePosts 批量保存历史列表中的文章概要, 返回新增、更新和没有变化的数量
+	SavePosts(ctx context.Context, posts []*model.Post) (SaveResult, error)
+
+	// SavePostDetail 保存文章详情
+	SavePostDetail(ctx context.Context, post *model.Post) error
+
+	// MarkPostInvalid 标记文章失效
+	MarkPostInvalid(ctx context.Context, msgBiz, msgMid, msgIdx, client string) error
+
+	// UpdateProfileFirstPublishAt 更新公众号第一篇文章的发布时间
+	UpdateProfileFirstPublishAt(ctx context.Context, msgBiz string, firstPublishAt time.Time) error
+
+	// UpdateProfileLatestPublishAt 更新公众号最新发布时间
+	UpdateProfileLatestPublishAt(ctx context.Context, msgBiz string, latestPublishAt time.Time) error
+
+	// UpsertDocument 按 keys 中的字段查找文档, 存在时更新其余字段, 不存在时插入. 用于声明式规则
+	UpsertDocument(ctx context.Context, collection string, keys []string, doc map[string]interface{}) error
+
+	// SaveDeadLetter 保存重试后仍失败的文章和最后一次的错误
+	SaveDeadLetter(ctx context.Context, post *model.Post, cause error, attempts int) error
+
+	// ListDeadLetters 按保存时间返回死信, limit 为 0 时返回全部
+	ListDeadLetters(ctx context.Context, limit int) ([]*model.DeadLetter, error)
+
+	// FindDeadLetters 按 ID 返回死信, 不存在的 ID 忽略
+	FindDeadLetters(ctx context.Context, ids []primitive.ObjectID) ([]*model.DeadLetter, error)
+
+	// DeleteDeadLetter 删除死信
+	DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error
+
+	// PurgeDeadLetters 删除全部死信, 返回删除的数量
+	PurgeDeadLetters(ctx context.Context) (int64, error)
+
+	// SaveShortLink 保存短链接对应的文章
+	SaveShortLink(ctx context.Context, link *model.ShortLink) error
+
+	// FindShortLink 查询短链接对应的文章, 没有记录时返回 nil
+	FindShortLink(ctx context.Context, shortID string) (*model.ShortLink, error)
+}
@@ -1,6 +1,11 @@
 package rules
 
-import "strings"
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+)
 
 type RuleType string
 
@@ -11,16 +16,56 @@ const (
 	RuleTypeLogger  RuleType = "logger"  // 注入的html发回的日志
 )
 
-// Rule 定义规则接口
+// Result 规则处理结果, 决定是否继续执行同一阶段的后续规则
+type Result int
+
+const (
+	Continue Result = iota // 继续执行后续规则
+	Stop                   // 停止执行后续规则
+)
+
+// 默认优先级和超时时间
+const (
+	DefaultPriority = 0
+	DefaultTimeout  = 10 * time.Second
+)
+
+// 内置规则的优先级: 公众号资料和文章列表先于文章内容保存, 下一个跳转链接最后应答.
+// 声明式规则默认使用 DefaultPriority, 在内置的保存规则之后、跳转链接之前执行
+const (
+	PriorityLogger    = -60
+	PriorityProfile   = -50
+	PriorityList      = -40
+	PriorityFirstPost = -30
+	PriorityContent   = -20
+	PriorityNextLink  = 100
+)
+
+// Rule 定义规则接口. 规则通过实现 RequestHandler 和/或 ResponseHandler
+// 分别挂载到请求阶段和响应阶段
 type Rule interface {
 	// Type 返回规则类型
 	Type() RuleType
 
+	// Priority 返回优先级, 数值越小越先执行, 相同优先级按注册顺序执行
+	Priority() int
+
+	// Timeout 返回单次处理的超时时间
+	Timeout() time.Duration
+
 	// Match 判断是否匹配该规则
 	Match(ctx *Context) bool
+}
+
+// RequestHandler 请求阶段的处理, 在请求转发到上游之前执行.
+// 设置 ctx.Reply 后由代理直接返回 ctx.Body, 不再请求上游
+type RequestHandler interface {
+	HandleRequest(ctx *Context) (Result, error)
+}
 
-	// Handle 处理匹配的内容
-	Handle(ctx *Context) error
+// ResponseHandler 响应阶段的处理, 在收到上游响应之后执行, 可以改写 ctx.Body
+type ResponseHandler interface {
+	HandleResponse(ctx *Context) (Result, error)
 }
 
 // Context 规则处理上下文
@@ -30,18 +75,59 @@ type Context struct {
 	Headers     map[string]string // 请求头
 	Body        []byte            // 响应内容
 	RequestBody []byte            // 请求内容
+	Client      string            // 客户端身份(代理用户名或来源IP)
+	StartedAt   time.Time         // 请求开始时间
+	Reply       bool              // 请求阶段由规则直接应答, 不再请求上游
+	ContentType string            // 响应类型, 响应阶段为上游返回的类型, 规则可以改写
+
+	ctx context.Context // 规则执行的上下文, 由 Manager 设置
+}
+
+// Context 返回规则执行的上下文, 规则超时后被取消. 读写数据库等耗时的操作应当使用它
+func (c *Context) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// clone 复制上下文, 规则在副本上执行, 成功后再写回.
+// 消息体也复制一份, 超时后仍在执行的规则不会改写调用方的数据
+func (c *Context) clone() *Context {
+	cp := *c
+	cp.Headers = make(map[string]string, len(c.Headers))
+	for k, v := range c.Headers {
+		cp.Headers[k] = v
+	}
+	cp.Body = bytes.Clone(c.Body)
+	cp.RequestBody = bytes.Clone(c.RequestBody)
+	return &cp
 }
 
 // BaseRule 基础规则结构
 type BaseRule struct {
 	ruleType   RuleType
-	urlPattern string // URL匹配模式
+	urlPattern string        // URL匹配模式
+	store      Store         // 持久化存储
+	priority   int           // 优先级, 数值越小越先执行
+	timeout    time.Duration // 超时时间, 为0时使用 DefaultTimeout
 }
 
 func (r *BaseRule) Type() RuleType {
 	return r.ruleType
 }
 
+func (r *BaseRule) Priority() int {
+	return r.priority
+}
+
+func (r *BaseRule) Timeout() time.Duration {
+	if r.timeout <= 0 {
+		return DefaultTimeout
+	}
+	return r.timeout
+}
+
 func (r *BaseRule) Match(ctx *Context) bool {
 	// 实现URL模式匹配
 	return strings.Contains(ctx.URL, r.urlPattern)
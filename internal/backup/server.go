@@ -9,15 +9,28 @@ import (
 	"github.com/elazarl/goproxy"
 	"github.com/marmotedu/errors"
 	"github.com/marmotedu/log"
+	"github.com/redis/go-redis/v9"
 	"io"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
-	"sync"
 	"time"
 	"wechat-backup/internal/backup/config"
 	rules2 "wechat-backup/internal/backup/rules"
 	"wechat-backup/internal/pkg/cert"
+	"wechat-backup/internal/pkg/har"
+	"wechat-backup/internal/pkg/lifecycle"
 	"wechat-backup/internal/pkg/mongo"
+	pkgoptions "wechat-backup/internal/pkg/options"
+	"wechat-backup/internal/pkg/pac"
+	"wechat-backup/internal/pkg/proxyauth"
+	"wechat-backup/internal/pkg/queue"
+	"wechat-backup/internal/pkg/upstream"
+	"wechat-backup/internal/pkg/util/hostmatch"
+	"wechat-backup/internal/pkg/util/httpbody"
+	"wechat-backup/internal/pkg/wxlink"
+	"wechat-backup/internal/repository"
 )
 
 //go:embed certs
@@ -26,6 +39,15 @@ var certsFS embed.FS
 type backupServer struct {
 	cfg *config.Config
 	ca  *tls.Certificate
+	// 存储, 连接MongoDB后创建
+	store rules2.Store
+	queue queue.Queue
+	// 文章处理协程池, 为空时规则同步保存文章
+	pool *rules2.ArticlePool
+	// 规则管理器, 创建代理时创建
+	manager *rules2.Manager
+	// 正在执行规则的请求
+	inflight inflight
 }
 
 // 注意: 这个提示并不影响内容解密: WARN: Cannot handshake client mp.weixin.qq.com:443 remote error: tls: unknown certificate
@@ -57,46 +79,281 @@ func createBackupServer(cfg *config.Config) *backupServer {
 	}
 }
 
+// 各阶段启动和关闭的默认超时, 关闭协程池时需要等待正在保存的文章
+const (
+	phaseTimeout       = 10 * time.Second
+	workersStopTimeout = 30 * time.Second
+)
+
+// Run 按顺序启动存储、队列、工作协程、代理和管理接口, ctx 取消后按相反顺序关闭:
+// 先停止接收请求并等待正在执行的规则, 再处理完队列中的文章, 最后关闭队列和存储
 func (s *backupServer) Run(ctx context.Context) error {
-	// 初始化MongoDB
+	lc := lifecycle.New(phaseTimeout)
+	lc.Append(
+		s.storeHook(),
+		s.queueHook(),
+		s.workersHook(),
+		s.proxyHook(),
+		s.adminHook(),
+	)
+
+	if err := lc.Start(ctx); err != nil {
+		return err
+	}
+
+	// 等待上下文取消
+	<-ctx.Done()
+
+	if err := lc.Stop(context.Background()); err != nil {
+		return fmt.Errorf("关闭服务失败: %v", err)
+	}
+	return nil
+}
+
+// storeHook 连接MongoDB并创建索引, 最后关闭
+func (s *backupServer) storeHook() lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "MongoDB",
+		Start: func(ctx context.Context) error {
+			if err := initMongo(s.cfg.MongoOptions); err != nil {
+				return err
+			}
+			repo := repository.New(mongo.GetMongoDB())
+			s.store = rules2.NewMongoStore(repo)
+
+			// 已有重复数据时唯一索引创建失败, 不影响保存, 只是不能防止并发写入产生重复文档
+			if err := repo.EnsureIndexes(ctx); err != nil {
+				log.Errorf("创建MongoDB索引失败: %v", err)
+			}
+			s.checkMigrations(ctx)
+			return nil
+		},
+		Stop: func(context.Context) error {
+			mongo.GetMongoDB().Close()
+			return nil
+		},
+	}
+}
+
+// checkMigrations 有未执行的数据库迁移时提示, 迁移需要手动执行
+func (s *backupServer) checkMigrations(ctx context.Context) {
+	runner, err := newMigrator()
+	if err != nil {
+		log.Errorf("检查数据库迁移失败: %v", err)
+		return
+	}
+
+	pending, err := runner.Pending(ctx)
+	if err != nil {
+		log.Errorf("检查数据库迁移失败: %v", err)
+		return
+	}
+	if len(pending) > 0 {
+		log.Warnf("有 %d 个数据库迁移未执行, 请运行 %s migrate up", len(pending), BASENAME)
+	}
+}
+
+// queueHook 创建文章处理队列. 队列由协程池关闭, 这里只释放 Redis 连接
+func (s *backupServer) queueHook() lifecycle.Hook {
+	var closeQueue func()
+	return lifecycle.Hook{
+		Name: "文章处理队列",
+		Start: func(ctx context.Context) error {
+			q, closeFn, err := s.newArticleQueue(ctx)
+			if err != nil {
+				return err
+			}
+			s.queue, closeQueue = q, closeFn
+			return nil
+		},
+		Stop: func(context.Context) error {
+			closeQueue()
+			return nil
+		},
+	}
+}
+
+// workersHook 启动文章处理协程池, 持久化队列中上次未处理完的文章会先被处理.
+// 关闭时等待队列中的文章保存完, 列出没有保存的文章
+func (s *backupServer) workersHook() lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "文章处理协程池",
+		Start: func(context.Context) error {
+			s.pool = rules2.NewArticlePool(s.store, s.queue, rules2.PoolConfig{
+				Workers:      s.cfg.QueueOptions.Workers,
+				Backpressure: s.cfg.QueueOptions.Backpressure,
+				PushTimeout:  s.cfg.QueueOptions.PushTimeout,
+				SpillDir:     s.cfg.QueueOptions.SpillDir,
+				Retry: rules2.RetryPolicy{
+					MaxRetries:     s.cfg.QueueOptions.MaxRetries,
+					InitialBackoff: s.cfg.QueueOptions.RetryBackoff,
+					MaxBackoff:     s.cfg.QueueOptions.RetryMaxBackoff,
+				},
+			})
+			return s.pool.Start()
+		},
+		Stop: func(ctx context.Context) error {
+			err := s.pool.Shutdown(ctx)
+			var unpersisted *rules2.UnpersistedError
+			if errors.As(err, &unpersisted) {
+				for _, item := range unpersisted.Items {
+					log.Errorf("文章未保存: [%s] %s: %s", item.Title, item.Link, item.Reason)
+				}
+			}
+			return err
+		},
+		StopTimeout: workersStopTimeout,
+	}
+}
+
+// proxyHook 启动代理服务器. 关闭时停止接收新请求, 等待正在执行的规则完成
+func (s *backupServer) proxyHook() lifecycle.Hook {
+	var (
+		srv        *http.Server
+		closeProxy func()
+	)
+	return lifecycle.Hook{
+		Name: "代理服务器",
+		Start: func(context.Context) error {
+			proxy, closeFn, err := s.newProxy()
+			if err != nil {
+				return err
+			}
+
+			handler, err := s.newHandler(proxy)
+			if err != nil {
+				closeFn()
+				return err
+			}
+
+			// 从配置中读取端口
+			addr := fmt.Sprintf("%s:%d",
+				s.cfg.ServerRunOptions.BindAddress,
+				s.cfg.ServerRunOptions.BindPort,
+			)
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				closeFn()
+				return fmt.Errorf("代理服务器监听 %s 失败: %v", addr, err)
+			}
+
+			srv, closeProxy = &http.Server{Handler: handler}, closeFn
+			go func() {
+				log.Infof("代理服务器启动于 %s, PAC地址: http://<本机IP>:%d%s", addr, s.cfg.ServerRunOptions.BindPort, pac.Path)
+				if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Errorf("代理服务器异常退出: %v", err)
+				}
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			defer closeProxy()
+
+			// MITM 连接被接管后不受 Shutdown 管理, 另外等待正在执行的规则
+			var errs []error
+			if err := srv.Shutdown(ctx); err != nil {
+				errs = append(errs, err)
+			}
+			if err := s.inflight.drain(ctx); err != nil {
+				errs = append(errs, err)
+			}
+			return errors.NewAggregate(errs)
+		},
+	}
+}
+
+// initMongo 按配置初始化MongoDB连接
+func initMongo(o *pkgoptions.MongoOptions) error {
+	uri, err := o.ConnectionURI()
+	if err != nil {
+		return err
+	}
+
 	mongoConfig := mongo.Config{
-		URI: fmt.Sprintf("mongodb://%s:%s@%s:%d",
-			s.cfg.MongoOptions.Username,
-			s.cfg.MongoOptions.Password,
-			s.cfg.MongoOptions.Host,
-			s.cfg.MongoOptions.Port,
-		),
-		Database:    s.cfg.MongoOptions.Database,
-		Timeout:     10 * time.Second,
-		MaxPoolSize: 100,
-		MinPoolSize: 10,
-		MaxIdleTime: 30 * time.Second,
-		RetryWrites: true,
-		RetryReads:  true,
-	}
-
-	// 如果没有设置用户名和密码，使用无认证的连接串
-	if s.cfg.MongoOptions.Username == "" || s.cfg.MongoOptions.Password == "" {
-		mongoConfig.URI = fmt.Sprintf("mongodb://%s:%d",
-			s.cfg.MongoOptions.Host,
-			s.cfg.MongoOptions.Port,
-		)
+		URI:         uri,
+		Database:    o.Database,
+		Timeout:     o.ConnectTimeout,
+		MaxPoolSize: o.MaxPoolSize,
+		MinPoolSize: o.MinPoolSize,
+		MaxIdleTime: o.MaxConnIdleTime,
+		RetryWrites: o.RetryWrites,
+		RetryReads:  o.RetryReads,
 	}
 
 	if err := mongo.InitMongoDB(mongoConfig); err != nil {
 		return fmt.Errorf("初始化MongoDB失败: %v", err)
 	}
-	defer mongo.GetMongoDB().Close()
+	return nil
+}
+
+// newArticleQueue 创建文章处理队列, 返回的关闭函数用于释放 Redis 连接
+func (s *backupServer) newArticleQueue(ctx context.Context) (queue.Queue, func(), error) {
+	opts := s.cfg.QueueOptions
+	if opts.Backend == "memory" {
+		log.Info("使用内存队列, 退出时未处理的文章会丢失; 需要持久化时设置 queue.backend: redis")
+		return queue.NewMemory(opts.Size), func() {}, nil
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     s.cfg.RedisOptions.GetAddr(),
+		Password: s.cfg.RedisOptions.Password,
+		DB:       s.cfg.RedisOptions.DB,
+	})
+	closeClient := func() {
+		if err := client.Close(); err != nil {
+			log.Warnf("关闭Redis连接失败: %v", err)
+		}
+	}
+
+	consumer := opts.Consumer
+	if consumer == "" {
+		consumer, _ = os.Hostname()
+	}
+
+	initCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	q, err := queue.NewRedis(initCtx, client, opts.Stream, opts.Group, consumer, opts.ClaimIdle)
+	if err != nil {
+		closeClient()
+		return nil, nil, fmt.Errorf("初始化文章处理队列失败: queue.backend 为 redis 时需要可用的Redis(%s), 不使用Redis时设置 queue.backend: memory: %v",
+			s.cfg.RedisOptions.GetAddr(), err)
+	}
+	q.SetMaxLen(int64(opts.Size))
+	log.Infof("文章处理队列: redis stream %s, 消费组 %s, 消费者 %s", opts.Stream, opts.Group, consumer)
+
+	return q, closeClient, nil
+}
 
-	// 创建代理服务器
+// newProxy 创建MITM代理, 返回的关闭函数用于释放HAR录制等资源
+func (s *backupServer) newProxy() (*goproxy.ProxyHttpServer, func(), error) {
 	proxy := goproxy.NewProxyHttpServer()
+	closeProxy := func() {}
 
 	if s.cfg.ServerRunOptions.Mode == "debug" {
 		proxy.Verbose = true
 	}
 
+	// 保留客户端的 Accept-Encoding, 上游可能返回 br/deflate 等 Transport 不会自动解压的编码,
+	// 响应由 decodeBody 统一解码后以 identity 返回
+	proxy.KeepAcceptEncoding = true
+
+	// 上游代理同时作用于解密后的请求(Tr)和透传的隧道(ConnectDial)
+	if s.cfg.ServerRunOptions.UpstreamProxy != "" {
+		up, err := upstream.New(s.cfg.ServerRunOptions.UpstreamProxy, s.cfg.ServerRunOptions.UpstreamBypass)
+		if err != nil {
+			return nil, nil, fmt.Errorf("初始化上游代理失败: %v", err)
+		}
+		proxy.Tr.Proxy = up.Proxy
+		proxy.ConnectDial = up.Dial
+		log.Infof("使用上游代理: %s", up)
+	}
+
 	// 重要!! 不加解析不到https内容
-	proxy.CertStore = NewCertStorage()
+	certStore, err := cert.NewStorage(s.ca, s.cfg.CertCacheOptions.Size, s.cfg.CertCacheOptions.Dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("初始化证书缓存失败: %v", err)
+	}
+	proxy.CertStore = certStore
 
 	// 创建自定义的MITM处理器
 	customCaMitm := &goproxy.ConnectAction{
@@ -107,6 +364,8 @@ func (s *backupServer) Run(ctx context.Context) error {
 	// 定义自定义的HTTPS处理函数
 	var customAlwaysMitm goproxy.FuncHttpsHandler = func(host string, ctx *goproxy.ProxyCtx) (*goproxy.ConnectAction, string) {
 		log.Infof("处理HTTPS请求: %s", host)
+		// 解密后的请求无法拿到 CONNECT 请求的 context, 通过 UserData 传递客户端身份
+		ctx.UserData = &rules2.Context{Client: proxyauth.ClientFromContext(ctx.Req.Context())}
 		return customCaMitm, host
 	}
 
@@ -115,148 +374,307 @@ func (s *backupServer) Run(ctx context.Context) error {
 
 	// MITM 原理: 客户端 <==(TLS 1)==> 代理 <==(TLS 2)==> 服务器
 
+	// 仅拦截配置中的主机, 其余 CONNECT 请求直接透传, 普通 HTTP 请求不经过规则直接转发
+	mitmHosts := hostmatch.New(s.cfg.MitmOptions.InterceptHosts()...)
+	log.Infof("MITM拦截主机: %v", s.cfg.MitmOptions.InterceptHosts())
+
 	// 设置MITM处理程序, 仅当wx的域名才处理
-	proxy.OnRequest(goproxy.ReqHostIs("mp.weixin.qq.com:443")).HandleConnect(customAlwaysMitm)
+	proxy.OnRequest(reqHostMatch(mitmHosts)).HandleConnect(customAlwaysMitm)
 
-	proxy.OnRequest().DoFunc(func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Request, *http.Response) {
+	// 配置了密钥时加密保存文章的原始链接
+	var sealer *wxlink.Sealer
+	key, err := s.cfg.LinkOptions.Key()
+	if err != nil {
+		return nil, nil, err
+	}
+	if key != nil {
+		if sealer, err = wxlink.NewSealer(key); err != nil {
+			return nil, nil, fmt.Errorf("初始化原始链接加密失败: %v", err)
+		}
+		log.Info("文章原始链接将加密保存")
+	}
+
+	// 规则管理器在启动时创建一次, 所有请求共用
+	manager := rules2.NewManager(s.store, s.pool, sealer)
+	captureRules, err := rules2.NewDeclarativeRules(s.cfg.CaptureOptions.Rules, s.store)
+	if err != nil {
+		return nil, nil, fmt.Errorf("初始化声明式抓取规则失败: %v", err)
+	}
+	manager.Register(captureRules...)
+	s.manager = manager
+	for _, r := range captureRules {
+		log.Infof("加载声明式抓取规则: %s", r.Type())
+	}
+
+	// HAR 录制, 放在其它可能失败的初始化之后, 出错返回时不会留下打开的文件
+	var recorder *har.Recorder
+	if s.cfg.HarOptions.Enabled {
+		redactor, err := har.NewRedactor(s.cfg.HarOptions.RedactParams, s.cfg.HarOptions.RedactHeaders, s.cfg.HarOptions.RedactBody)
+		if err != nil {
+			return nil, nil, fmt.Errorf("初始化HAR脱敏规则失败: %v", err)
+		}
+		recorder, err = har.NewRecorder(s.cfg.HarOptions.Dir, int64(s.cfg.HarOptions.MaxSize)<<20, s.cfg.HarOptions.MaxAge, redactor)
+		if err != nil {
+			return nil, nil, fmt.Errorf("初始化HAR录制失败: %v", err)
+		}
+		closeProxy = func() {
+			if err := recorder.Close(); err != nil {
+				log.Warnf("关闭HAR录制失败: %v", err)
+			}
+		}
+	}
+
+	// 命中规则时最多缓冲的消息体大小
+	maxBodySize := int64(s.cfg.MitmOptions.MaxBodySize) << 10
+	// record 是否需要录制该请求
+	record := func(ruleCtx *rules2.Context) bool {
+		return recorder != nil && (!s.cfg.HarOptions.OnlyMatched || len(manager.Matched(ruleCtx)) > 0)
+	}
+
+	proxy.OnRequest(reqHostMatch(mitmHosts)).DoFunc(func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Request, *http.Response) {
 		if req == nil {
 			return req, nil
 		}
 
-		// 读取请求体
-		requestBody, err := io.ReadAll(req.Body)
+		// 关闭过程中不再执行规则, 直接透传
+		if !s.inflight.enter() {
+			return req, nil
+		}
+		defer s.inflight.leave()
+
+		ruleCtx := &rules2.Context{
+			URL:       req.URL.String(),
+			Method:    req.Method,
+			Headers:   make(map[string]string),
+			Client:    requestClient(req, ctx),
+			StartedAt: time.Now(),
+		}
+		ctx.UserData = ruleCtx
+
+		// 复制请求头
+		for k, v := range req.Header {
+			if len(v) > 0 {
+				ruleCtx.Headers[k] = v[0]
+			}
+		}
+
+		// 先按 URL 和方法匹配, 只有请求阶段的规则或 HAR 录制需要请求体, 其余直接流式透传
+		if !manager.HasRequestHandler(ruleCtx) && !record(ruleCtx) {
+			return req, nil
+		}
+
+		requestBody, rc, ok, err := bufferBody(req.Body, maxBodySize)
+		req.Body = rc
 		if err != nil {
 			log.Errorf("读取请求体失败: %v", err)
 			return req, nil
 		}
+		if !ok {
+			log.Warnf("请求体超过 %d KB, 跳过规则: %s", s.cfg.MitmOptions.MaxBodySize, wxlink.Redact(ruleCtx.URL))
+			return req, nil
+		}
 
-		// 恢复请求体
-		req.Body = io.NopCloser(bytes.NewReader(requestBody))
+		// 上游收到的仍是原始内容, 规则看到的是解码后的明文
+		ruleCtx.RequestBody = requestBody
+		if decoded, _, err := decodeBody(requestBody, req.Header, maxBodySize); errors.Is(err, httpbody.ErrTooLarge) {
+			log.Warnf("解压后的请求体超过 %d KB, 跳过规则: %s", s.cfg.MitmOptions.MaxBodySize, wxlink.Redact(ruleCtx.URL))
+			return req, nil
+		} else if err != nil {
+			log.Warnf("解码请求体失败: %v", err)
+		} else {
+			ruleCtx.RequestBody = decoded
+		}
+
+		// 请求阶段的规则, 错误已由规则管理器记录
+		_ = manager.HandleRequest(ruleCtx)
 
-		// 将请求体存储到上下文中
-		ctx.UserData = &rules2.Context{
-			RequestBody: requestBody,
+		// 规则直接应答, 不再请求上游
+		if ruleCtx.Reply {
+			return req, goproxy.NewResponse(req, ruleCtx.ContentType, http.StatusOK, string(ruleCtx.Body))
 		}
 
 		return req, nil
 	})
 
-	proxy.OnResponse().DoFunc(func(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
+	proxy.OnResponse(reqHostMatch(mitmHosts)).DoFunc(func(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
 		if resp == nil || resp.Request == nil {
 			return resp
 		}
 
+		if !s.inflight.enter() {
+			return resp
+		}
+		defer s.inflight.leave()
+
 		if ctx.UserData == nil {
 			log.Error("UserData is nil")
 			return resp
 		}
 
-		userData, ok := ctx.UserData.(*rules2.Context)
+		ruleCtx, ok := ctx.UserData.(*rules2.Context)
 		if !ok {
 			log.Error("UserData is not of type *rules2.Context")
 			return resp
 		}
 
-		ruleCtx := &rules2.Context{
-			URL:         resp.Request.URL.String(),
-			Method:      resp.Request.Method,
-			Headers:     make(map[string]string),
-			RequestBody: userData.RequestBody,
+		// 请求阶段已经应答的响应由规则生成, 不需要再处理
+		if ruleCtx.Reply {
+			return resp
 		}
 
-		// 复制请求头
-		for k, v := range resp.Request.Header {
-			if len(v) > 0 {
-				ruleCtx.Headers[k] = v[0]
-			}
+		// 没有响应阶段的规则也不需要录制时直接流式透传, 不缓冲视频、图片等大文件
+		ruleCtx.ContentType = resp.Header.Get("Content-Type")
+		if !manager.HasResponseHandler(ruleCtx) && !record(ruleCtx) {
+			return resp
 		}
 
-		// 读取响应体
-		body, err := io.ReadAll(resp.Body)
+		raw, rc, ok, err := bufferBody(resp.Body, maxBodySize)
+		resp.Body = rc
 		if err != nil {
 			log.Errorf("读取响应体失败: %v", err)
 			return resp
 		}
-		ruleCtx.Body = body
-
-		//fmt.Printf("%s\n", ruleCtx.Body)
+		if !ok {
+			log.Warnf("响应体超过 %d KB, 跳过规则: %s", s.cfg.MitmOptions.MaxBodySize, wxlink.Redact(ruleCtx.URL))
+			return resp
+		}
 
-		// 应用规则
-		if err := rules2.NewManager().Handle(ruleCtx); err != nil {
-			log.Errorf("规则处理失败: %+v", err)
+		// 解压并转换为 UTF-8, 之后以 identity 编码返回给客户端
+		body, contentType, err := decodeBody(raw, resp.Header, maxBodySize)
+		if errors.Is(err, httpbody.ErrTooLarge) {
+			log.Warnf("解压后的响应体超过 %d KB, 跳过规则: %s", s.cfg.MitmOptions.MaxBodySize, wxlink.Redact(ruleCtx.URL))
+			resp.Body = io.NopCloser(bytes.NewReader(raw))
+			return resp
+		}
+		if err != nil {
+			log.Warnf("解码响应体失败, 跳过规则: %v", err)
+			resp.Body = io.NopCloser(bytes.NewReader(raw))
+			return resp
+		}
+		resp.Header.Del("Content-Encoding")
+		if contentType != "" {
+			resp.Header.Set("Content-Type", contentType)
+		}
+		setResponseBody(resp, body)
+		ruleCtx.ContentType = contentType
+
+		// 录制原始请求和响应, 在规则改写响应之前
+		if record(ruleCtx) {
+			entry := har.NewEntry(ruleCtx.StartedAt, resp.Request, ruleCtx.RequestBody, resp, body)
+			if err := recorder.Record(entry); err != nil {
+				log.Warnf("录制HAR失败: %v", err)
+			}
 		}
 
+		ruleCtx.Body = body
+
+		// 响应阶段的规则, 错误已由规则管理器记录
+		_ = manager.HandleResponse(ruleCtx)
+
 		// 恢复响应体
-		resp.Body = io.NopCloser(bytes.NewReader(ruleCtx.Body))
-		resp.ContentLength = int64(len(ruleCtx.Body))
-		resp.Header.Set("Content-Length", strconv.Itoa(len(ruleCtx.Body)))
+		setResponseBody(resp, ruleCtx.Body)
+		if ruleCtx.ContentType != "" {
+			resp.Header.Set("Content-Type", ruleCtx.ContentType)
+		}
 
 		return resp
 	})
 
-	// 从配置中读取端口
-	addr := fmt.Sprintf("%s:%d",
-		s.cfg.ServerRunOptions.BindAddress,
-		s.cfg.ServerRunOptions.BindPort,
-	)
+	// 直接访问代理时提供 PAC 文件, 只让需要拦截的主机走代理
+	mux := http.NewServeMux()
+	mux.HandleFunc(pac.Path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", pac.ContentType)
+		_, _ = io.WriteString(w, pac.Generate(r.Host, mitmHosts.Hosts()))
+	})
+	proxy.NonproxyHandler = mux
 
-	// 创建HTTP服务器
-	srv := &http.Server{
-		Addr:    addr,
-		Handler: proxy,
+	return proxy, closeProxy, nil
+}
+
+// newHandler 在代理之前加上客户端访问控制
+func (s *backupServer) newHandler(proxy *goproxy.ProxyHttpServer) (http.Handler, error) {
+	// PAC 文件需要在设备配置代理之前获取, 无需认证
+	guard, err := proxyauth.New(s.cfg.ProxyAuthOptions.UserMap(), s.cfg.ProxyAuthOptions.AllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("初始化访问控制失败: %v", err)
 	}
+	guard.Public(pac.Path)
 
-	// 在goroutine中启动服务器
-	go func() {
-		log.Infof("代理服务器启动于 %s", addr)
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("代理服务器启动失败: %v", err)
-		}
-	}()
+	return guard.Wrap(proxy), nil
+}
 
-	// 等待上下文取消
-	<-ctx.Done()
+// decodeBody 按消息头解压消息体, 文本内容转换为 UTF-8, 返回解码后的内容和对应的 Content-Type.
+// 解压后超过 limit 字节时返回 httpbody.ErrTooLarge
+func decodeBody(body []byte, header http.Header, limit int64) ([]byte, string, error) {
+	contentType := header.Get("Content-Type")
+	body, err := httpbody.Decompress(body, header.Get("Content-Encoding"), limit)
+	if err != nil {
+		return nil, contentType, err
+	}
 
-	// 优雅关闭服务器
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	utf8Body, converted, err := httpbody.ToUTF8(body, contentType)
+	if err != nil {
+		// 字符集无法识别时保留原文, 规则仍可以处理 ASCII 部分
+		log.Warnf("转换字符集失败: %v", err)
+		return body, contentType, nil
+	}
+	if converted {
+		return utf8Body, httpbody.WithCharset(contentType, "utf-8"), nil
+	}
+	return body, contentType, nil
+}
 
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		return fmt.Errorf("关闭服务器失败: %v", err)
+// bufferBody 最多读取 limit 字节的消息体. 超过上限时返回 false,
+// 返回的 ReadCloser 依次包含已读取的部分和剩余部分, 可以原样透传
+func bufferBody(body io.ReadCloser, limit int64) ([]byte, io.ReadCloser, bool, error) {
+	if body == nil {
+		return nil, nil, true, nil
 	}
 
-	return nil
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, body, false, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), body), body}, false, nil
+	}
+
+	_ = body.Close()
+	return data, io.NopCloser(bytes.NewReader(data)), true, nil
 }
 
-// CertStorage is a simple certificate cache that keeps
-// everything in memory.
-type CertStorage struct {
-	certs map[string]*tls.Certificate
-	mtx   sync.RWMutex
+// setResponseBody 替换响应体并更新长度
+func setResponseBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
 }
 
-func (cs *CertStorage) Fetch(hostname string, gen func() (*tls.Certificate, error)) (*tls.Certificate, error) {
-	cs.mtx.RLock()
-	cert1, ok := cs.certs[hostname]
-	cs.mtx.RUnlock()
-	if ok {
-		return cert1, nil
+// reqHostMatch 返回按主机过滤请求的条件, 同时适用于 CONNECT 请求和解密后的请求
+func reqHostMatch(m *hostmatch.Matcher) goproxy.ReqConditionFunc {
+	return func(req *http.Request, ctx *goproxy.ProxyCtx) bool {
+		return req != nil && m.Match(requestAddr(req))
 	}
+}
 
-	cert1, err := gen()
-	if err != nil {
-		return nil, err
+// requestClient 返回请求所属的客户端身份, 解密后的请求从 CONNECT 阶段的 UserData 中继承
+func requestClient(req *http.Request, ctx *goproxy.ProxyCtx) string {
+	if userData, ok := ctx.UserData.(*rules2.Context); ok && userData.Client != "" {
+		return userData.Client
 	}
-
-	cs.mtx.Lock()
-	cs.certs[hostname] = cert1
-	cs.mtx.Unlock()
-
-	return cert1, nil
+	return proxyauth.ClientFromContext(req.Context())
 }
 
-func NewCertStorage() *CertStorage {
-	return &CertStorage{
-		certs: make(map[string]*tls.Certificate),
+// requestAddr 返回请求的目标地址, 没有端口时按协议补全默认端口
+func requestAddr(req *http.Request) string {
+	host := req.URL.Host
+	if host == "" {
+		host = req.Host
 	}
+
+	return hostmatch.WithDefaultPort(host, req.URL.Scheme)
 }
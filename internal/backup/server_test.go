@@ -0,0 +1,382 @@
+package backup
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"wechat-backup/internal/backup/config"
+	"wechat-backup/internal/backup/fakewechat"
+	"wechat-backup/internal/backup/options"
+	"wechat-backup/internal/backup/rules"
+	"wechat-backup/internal/model"
+	pkgoptions "wechat-backup/internal/pkg/options"
+	"wechat-backup/internal/pkg/queue"
+)
+
+// testHarness 端到端测试环境: 客户端 → 代理 → 规则 → 内存存储, 上游为假的微信服务
+type testHarness struct {
+	fake   *fakewechat.Server
+	store  *rules.MemoryStore
+	server *backupServer
+	proxy  *httptest.Server
+	client *http.Client
+}
+
+// newHarness 创建测试代理, setup 在创建代理之前调整服务
+func newHarness(t *testing.T, opts *options.Options, setup func(s *backupServer)) *testHarness {
+	t.Helper()
+
+	if opts == nil {
+		opts = options.NewOptions()
+	}
+
+	fake := fakewechat.New(filepath.Join("rules", "testdata", "golden"))
+	t.Cleanup(fake.Close)
+
+	ca := newTestCA(t)
+	store := rules.NewMemoryStore()
+	s := &backupServer{
+		cfg:   &config.Config{Options: opts},
+		ca:    ca,
+		store: store,
+	}
+	if setup != nil {
+		setup(s)
+	}
+
+	proxy, closeProxy, err := s.newProxy()
+	require.NoError(t, err)
+	t.Cleanup(closeProxy)
+
+	// 所有上游连接都指向假服务
+	proxy.Tr.Proxy = nil
+	proxy.Tr.DialContext = fake.DialContext
+
+	handler, err := s.newHandler(proxy)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	proxyURL, _ := url.Parse(srv.URL)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	return &testHarness{
+		fake:   fake,
+		store:  store,
+		server: s,
+		proxy:  srv,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyURL(proxyURL),
+				TLSClientConfig: &tls.Config{RootCAs: roots},
+			},
+		},
+	}
+}
+
+// get 通过代理请求并返回响应体
+func (h *testHarness) get(t *testing.T, link string) (int, string) {
+	t.Helper()
+
+	resp, err := h.client.Get(link)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+// post 查找文章
+func (h *testHarness) post(msgBiz, msgMid, msgIdx string) *model.Post {
+	for _, p := range h.store.Posts() {
+		if p.MsgBiz == msgBiz && p.MsgMid == msgMid && p.MsgIdx == msgIdx {
+			return p
+		}
+	}
+	return nil
+}
+
+func newTestCA(t *testing.T) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "wx-backup test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestEndToEnd(t *testing.T) {
+	h := newHarness(t, nil, nil)
+	biz := url.QueryEscape(fakewechat.Biz)
+
+	t.Run("profile home", func(t *testing.T) {
+		status, body := h.get(t, "https://mp.weixin.qq.com/mp/profile_ext?action=home&__biz="+biz+"&scene=124")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, "/wx/profiles/next_link")
+		assert.NotContains(t, body, "headTrap")
+
+		profiles := h.store.Profiles()
+		require.Len(t, profiles, 1)
+		assert.Equal(t, fakewechat.Biz, profiles[0].MsgBiz)
+		assert.Equal(t, "测试公众号", profiles[0].Title)
+		assert.Equal(t, "gh_0123456789ab", profiles[0].Username)
+		assert.Equal(t, "这是一个用于测试的公众号", profiles[0].Desc)
+		assert.Equal(t, "127.0.0.1", profiles[0].CapturedBy)
+		assert.Equal(t, int64(1704160800), profiles[0].LatestPublishAt.Unix())
+
+		first := h.post(fakewechat.Biz, fakewechat.MidNormal, "1")
+		require.NotNil(t, first)
+		assert.Equal(t, "第一篇测试文章", first.Title)
+		assert.Equal(t, "张三", first.Author)
+		assert.Equal(t, 11, first.CopyrightStat)
+
+		second := h.post(fakewechat.Biz, fakewechat.MidNormal, "2")
+		require.NotNil(t, second)
+		assert.Equal(t, "第二篇测试文章", second.Title)
+	})
+
+	t.Run("history list", func(t *testing.T) {
+		status, _ := h.get(t, "https://mp.weixin.qq.com/mp/profile_ext?action=getmsg&__biz="+biz+"&offset=10&count=10&f=json")
+		assert.Equal(t, http.StatusOK, status)
+
+		p := h.post(fakewechat.Biz, "2650000000", "1")
+		require.NotNil(t, p)
+		assert.Equal(t, "更早的一篇文章", p.Title)
+		assert.Equal(t, "https://example.com/original", p.SourceURL)
+		assert.Equal(t, int64(1703988000), p.PublishAt.Unix())
+	})
+
+	t.Run("article", func(t *testing.T) {
+		status, body := h.get(t, "https://mp.weixin.qq.com/s?__biz="+biz+"&mid="+fakewechat.MidNormal+"&idx=1&sn=0123456789abcdef0123456789abcdef")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, "/wx/posts/next_link")
+
+		p := h.post(fakewechat.Biz, fakewechat.MidNormal, "1")
+		require.NotNil(t, p)
+		assert.Contains(t, p.Content, "这是正文的第一段。")
+		assert.Contains(t, p.HTML, "https://mmbiz.qpic.cn/mmbiz_png/example/640?wx_fmt=png")
+		assert.Equal(t, int64(1024), p.ReadNum)
+		assert.Equal(t, int64(32), p.LikeNum)
+		assert.False(t, p.IsFail)
+	})
+
+	t.Run("deleted article", func(t *testing.T) {
+		h.get(t, "https://mp.weixin.qq.com/s?__biz="+biz+"&mid="+fakewechat.MidDeleted+"&idx=1&sn=x")
+
+		p := h.post(fakewechat.Biz, fakewechat.MidDeleted, "1")
+		require.NotNil(t, p)
+		assert.True(t, p.IsFail)
+	})
+
+	t.Run("violation article", func(t *testing.T) {
+		h.get(t, "https://mp.weixin.qq.com/s?__biz="+biz+"&mid="+fakewechat.MidViolation+"&idx=1&sn=x")
+
+		p := h.post(fakewechat.Biz, fakewechat.MidViolation, "1")
+		require.NotNil(t, p)
+		assert.True(t, p.IsFail)
+	})
+
+	t.Run("short link article", func(t *testing.T) {
+		status, _ := h.get(t, "https://mp.weixin.qq.com/s/"+fakewechat.ShortLinkID)
+		assert.Equal(t, http.StatusOK, status)
+
+		// 短链接的 URL 中没有 __biz/mid/idx, 使用页面变量中的标识保存
+		p := h.post(fakewechat.Biz, "2650000004", "1")
+		require.NotNil(t, p)
+		assert.Equal(t, "短链接测试文章", p.Title)
+	})
+
+	t.Run("legacy appmsg show article", func(t *testing.T) {
+		status, _ := h.get(t, "https://mp.weixin.qq.com/mp/appmsg/show?__biz="+biz+"&appmsgid="+fakewechat.AppMsgIDLegacy+"&itemidx=2&sign=x")
+		assert.Equal(t, http.StatusOK, status)
+
+		p := h.post(fakewechat.Biz, fakewechat.AppMsgIDLegacy, "2")
+		require.NotNil(t, p)
+		assert.Equal(t, "旧版图文消息", p.Title)
+		assert.Contains(t, p.Content, "这是旧版图文消息的正文")
+	})
+
+	t.Run("getappmsgext passes through", func(t *testing.T) {
+		resp, err := h.client.Post("https://mp.weixin.qq.com/mp/getappmsgext?__biz="+biz+"&mid="+fakewechat.MidNormal,
+			"application/x-www-form-urlencoded", strings.NewReader("is_only_read=1"))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		want, _ := h.fake.Fixture("getappmsgext.json")
+		assert.Equal(t, string(want), string(body))
+	})
+
+	t.Run("local endpoints reply without upstream", func(t *testing.T) {
+		resp, err := h.client.Get("https://mp.weixin.qq.com/wx/profiles/next_link")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.JSONEq(t, `{"data":""}`, string(body))
+	})
+
+	t.Run("compressed responses are decoded before rules", func(t *testing.T) {
+		for _, enc := range []string{"br", "gzip", "deflate"} {
+			req, err := http.NewRequest(http.MethodGet, "https://mp.weixin.qq.com/s?__biz="+biz+"&mid="+fakewechat.MidNormal+"&idx=1&sn=x", nil)
+			require.NoError(t, err)
+			// 显式设置后客户端不会自动解压, 可以看到代理返回的原始内容
+			req.Header.Set("Accept-Encoding", enc)
+
+			resp, err := h.client.Do(req)
+			require.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			assert.Empty(t, resp.Header.Get("Content-Encoding"), enc)
+			assert.Contains(t, string(body), "/wx/posts/next_link", enc)
+		}
+	})
+
+	assert.Contains(t, h.fake.Requests(), "POST /mp/getappmsgext?__biz="+biz+"&mid="+fakewechat.MidNormal)
+	assert.NotContains(t, h.fake.Requests(), "GET /wx/profiles/next_link")
+}
+
+func TestEndToEndProxyAuth(t *testing.T) {
+	opts := options.NewOptions()
+	opts.ProxyAuthOptions.Users = append(opts.ProxyAuthOptions.Users,
+		pkgoptions.ProxyUser{Username: "phone1", Password: "secret"})
+	h := newHarness(t, opts, nil)
+
+	// 未认证的请求被拒绝
+	_, err := h.client.Get("https://mp.weixin.qq.com/mp/profile_ext?action=home&__biz=" + url.QueryEscape(fakewechat.Biz))
+	assert.Error(t, err)
+	assert.Empty(t, h.store.Profiles())
+
+	// 认证后记录客户端身份
+	proxyURL, _ := url.Parse(h.proxy.URL)
+	proxyURL.User = url.UserPassword("phone1", "secret")
+	h.client.Transport.(*http.Transport).Proxy = http.ProxyURL(proxyURL)
+
+	status, _ := h.get(t, "https://mp.weixin.qq.com/mp/profile_ext?action=home&__biz="+url.QueryEscape(fakewechat.Biz))
+	assert.Equal(t, http.StatusOK, status)
+
+	profiles := h.store.Profiles()
+	require.Len(t, profiles, 1)
+	assert.Equal(t, "phone1", profiles[0].CapturedBy)
+}
+
+func TestEndToEndMaxBodySize(t *testing.T) {
+	opts := options.NewOptions()
+	opts.MitmOptions.MaxBodySize = 1
+	h := newHarness(t, opts, nil)
+
+	// 超过上限的页面原样透传, 不交给规则. 上限按传输的字节计算, 不压缩才能超过
+	req, err := http.NewRequest(http.MethodGet, "https://mp.weixin.qq.com/s?__biz="+url.QueryEscape(fakewechat.Biz)+"&mid="+fakewechat.MidNormal+"&idx=1&sn=x", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := h.client.Do(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	want, _ := h.fake.Fixture("article.html")
+	assert.Equal(t, string(want), string(body))
+	assert.Nil(t, h.post(fakewechat.Biz, fakewechat.MidNormal, "1"))
+
+	// 压缩后不超过上限、解压后超过上限的页面同样原样透传
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = h.client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Nil(t, h.post(fakewechat.Biz, fakewechat.MidNormal, "1"))
+
+	// 不超过上限的响应照常处理
+	status, _ := h.get(t, "https://mp.weixin.qq.com/mp/profile_ext?action=getmsg&__biz="+url.QueryEscape(fakewechat.Biz)+"&offset=10&count=10&f=json")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotNil(t, h.post(fakewechat.Biz, "2650000000", "1"))
+}
+
+func TestPAC(t *testing.T) {
+	h := newHarness(t, nil, nil)
+
+	resp, err := http.Get(h.proxy.URL + "/proxy.pac")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "application/x-ns-proxy-autoconfig", resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), `shExpMatch(host, "mp.weixin.qq.com")`)
+	assert.NotContains(t, string(body), "mmbiz.qpic.cn")
+}
+
+func TestEndToEndArticlePool(t *testing.T) {
+	var pool *rules.ArticlePool
+	h := newHarness(t, nil, func(s *backupServer) {
+		pool = rules.NewArticlePool(s.store, queue.NewMemory(10), rules.PoolConfig{Workers: 2})
+		require.NoError(t, pool.Start())
+		t.Cleanup(func() { _ = pool.Shutdown(context.Background()) })
+		s.pool = pool
+	})
+
+	// 文章经过协程池异步保存
+	status, _ := h.get(t, "https://mp.weixin.qq.com/s?__biz="+url.QueryEscape(fakewechat.Biz)+"&mid="+fakewechat.MidNormal+"&idx=1&sn=0123456789abcdef0123456789abcdef")
+	assert.Equal(t, http.StatusOK, status)
+	require.Eventually(t, func() bool { return len(h.store.Posts()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	admin := httptest.NewServer(h.server.newAdminHandler())
+	defer admin.Close()
+	resp, err := http.Get(admin.URL + poolStatsPath)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var stats rules.PoolStats
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	assert.True(t, stats.Running)
+	assert.EqualValues(t, 1, stats.Submitted)
+	require.Len(t, stats.Workers, 2)
+	assert.EqualValues(t, 1, stats.Workers[0].Processed+stats.Workers[1].Processed)
+
+	resp, err = http.Get(admin.URL + ruleStatsPath)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var ruleStats rules.ManagerStats
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ruleStats))
+	assert.Zero(t, ruleStats.Abandoned)
+}
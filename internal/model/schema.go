@@ -0,0 +1,81 @@
+package model
+
+import "strings"
+
+// 集合名
+const (
+	CollectionProfiles    = "profiles"
+	CollectionPosts       = "posts"
+	CollectionMessages    = "messages"
+	CollectionMedia       = "media"
+	CollectionDeadLetters = "dead_letters"
+	CollectionShortLinks  = "short_links"
+	// CollectionMigrations 已执行的数据库迁移
+	CollectionMigrations = "schema_migrations"
+)
+
+// IsReservedCollection 集合是否由程序管理, 声明式抓取规则不能写入这些集合和 MongoDB 的 system. 集合
+func IsReservedCollection(name string) bool {
+	switch name {
+	case CollectionProfiles, CollectionPosts, CollectionMessages, CollectionMedia,
+		CollectionDeadLetters, CollectionShortLinks, CollectionMigrations:
+		return true
+	}
+	return strings.HasPrefix(name, "system.")
+}
+
+// 字段名, 与模型的 bson 标签一致. 使用 bson.M 读写时引用这些常量, 不要直接写字段名
+const (
+	FieldID        = "_id"
+	FieldCreatedAt = "createdAt"
+	FieldUpdatedAt = "updatedAt"
+
+	// 公众号和文章共有
+	FieldMsgBiz     = "msgBiz"
+	FieldTitle      = "title"
+	FieldUsername   = "username"
+	FieldCapturedBy = "capturedBy"
+
+	// 公众号
+	FieldHeadimg           = "headimg"
+	FieldDesc              = "desc"
+	FieldMaxDayPubCount    = "maxDayPubCount"
+	FieldOpenHistoryPageAt = "openHistoryPageAt"
+	FieldFirstPublishAt    = "firstPublishAt"
+	FieldLatestPublishAt   = "latestPublishAt"
+
+	// 文章
+	FieldMsgMid        = "msgMid"
+	FieldMsgIdx        = "msgIdx"
+	FieldLink          = "link"
+	FieldRawLink       = "rawLink"
+	FieldPublishAt     = "publishAt"
+	FieldCover         = "cover"
+	FieldDigest        = "digest"
+	FieldContent       = "content"
+	FieldHTML          = "html"
+	FieldSourceURL     = "sourceUrl"
+	FieldAuthor        = "author"
+	FieldCopyrightStat = "copyrightStat"
+	FieldWechatID      = "wechatId"
+	FieldReadNum       = "readNum"
+	FieldLikeNum       = "likeNum"
+	FieldIsFail        = "isFail"
+
+	// 消息和媒体文件
+	FieldProfileID   = "profileId"
+	FieldContentType = "contentType"
+	FieldSendTime    = "sendTime"
+	FieldType        = "type"
+	FieldURL         = "url"
+	FieldPath        = "path"
+	FieldMessageID   = "messageId"
+
+	// 死信
+	FieldPost     = "post"
+	FieldError    = "error"
+	FieldAttempts = "attempts"
+
+	// 短链接
+	FieldShortID = "shortId"
+)
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 模型的 bson 字段必须在 schema.go 中定义, 规则和模型使用同一套字段名
+func TestModelFieldsDefined(t *testing.T) {
+	known := map[string]bool{}
+	for _, f := range []string{
+		FieldID, FieldCreatedAt, FieldUpdatedAt, FieldMsgBiz, FieldTitle, FieldUsername, FieldCapturedBy,
+		FieldHeadimg, FieldDesc, FieldMaxDayPubCount, FieldOpenHistoryPageAt, FieldFirstPublishAt, FieldLatestPublishAt,
+		FieldMsgMid, FieldMsgIdx, FieldLink, FieldRawLink, FieldPublishAt, FieldCover, FieldDigest, FieldContent, FieldHTML,
+		FieldSourceURL, FieldAuthor, FieldCopyrightStat, FieldWechatID, FieldReadNum, FieldLikeNum, FieldIsFail,
+		FieldProfileID, FieldContentType, FieldSendTime, FieldType, FieldURL, FieldPath, FieldMessageID,
+		FieldPost, FieldError, FieldAttempts, FieldShortID,
+	} {
+		known[f] = true
+	}
+
+	for _, m := range []interface{}{BaseModel{}, Profile{}, Post{}, DeadLetter{}, Message{}, Media{}, ShortLink{}} {
+		typ := reflect.TypeOf(m)
+		for i := 0; i < typ.NumField(); i++ {
+			name := strings.Split(typ.Field(i).Tag.Get("bson"), ",")[0]
+			if name == "" {
+				continue
+			}
+			assert.True(t, known[name], "%s.%s: 字段 %s 未在 schema.go 中定义", typ.Name(), typ.Field(i).Name, name)
+		}
+	}
+}
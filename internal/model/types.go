@@ -8,8 +8,8 @@ import (
 // BaseModel 包含所有模型共有的字段
 type BaseModel struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
 // Profile 基本资料
@@ -24,15 +24,16 @@ type Profile struct {
 	OpenHistoryPageAt time.Time `bson:"openHistoryPageAt" json:"openHistoryPageAt"`
 	FirstPublishAt    time.Time `bson:"firstPublishAt" json:"firstPublishAt"`
 	LatestPublishAt   time.Time `bson:"latestPublishAt" json:"latestPublishAt"`
+	CapturedBy        string    `bson:"capturedBy" json:"capturedBy"` // 抓取该资料的客户端
 }
 
 // Message 消息模型
 type Message struct {
 	BaseModel   `bson:",inline"`
-	ProfileID   primitive.ObjectID `bson:"profile_id" json:"profile_id"`
+	ProfileID   primitive.ObjectID `bson:"profileId" json:"profileId"`
 	Content     string             `bson:"content" json:"content"`
-	ContentType string             `bson:"content_type" json:"content_type"`
-	SendTime    time.Time          `bson:"send_time" json:"send_time"`
+	ContentType string             `bson:"contentType" json:"contentType"`
+	SendTime    time.Time          `bson:"sendTime" json:"sendTime"`
 }
 
 // Media 媒体文件模型
@@ -41,7 +42,7 @@ type Media struct {
 	Type      string             `bson:"type" json:"type"`
 	URL       string             `bson:"url" json:"url"`
 	Path      string             `bson:"path" json:"path"`
-	MessageID primitive.ObjectID `bson:"message_id" json:"message_id"`
+	MessageID primitive.ObjectID `bson:"messageId" json:"messageId"`
 }
 
 type Post struct {
@@ -50,7 +51,7 @@ type Post struct {
 	MsgMid        string    `bson:"msgMid" json:"msgMid"`               // 消息mid
 	MsgIdx        string    `bson:"msgIdx" json:"msgIdx"`               // 消息idx
 	Title         string    `bson:"title" json:"title"`                 // 文章标题
-	Link          string    `bson:"link" json:"link"`                   // 文章链接
+	Link          string    `bson:"link" json:"link"`                   // 规范链接, 只包含 __biz、mid、idx 和 sn
 	PublishAt     time.Time `bson:"publishAt" json:"publishAt"`         // 发布时间
 	Cover         string    `bson:"cover" json:"cover"`                 // 封面图片
 	Digest        string    `bson:"digest" json:"digest"`               // 文章摘要
@@ -64,6 +65,27 @@ type Post struct {
 	ReadNum       int64     `bson:"readNum" json:"readNum"`             // 阅读数
 	LikeNum       int64     `bson:"likeNum" json:"likeNum"`             // 点赞数
 	IsFail        bool      `bson:"isFail" json:"isFail"`               // 是否抓取失败
+	CapturedBy    string    `bson:"capturedBy" json:"capturedBy"`       // 抓取该文章的客户端
+
+	// 加密的原始链接, 带有 key、pass_ticket 等阅读者的会话参数, 未配置密钥时为空
+	RawLink string `bson:"rawLink,omitempty" json:"rawLink,omitempty"`
+}
+
+// DeadLetter 重试后仍保存失败的文章, 可以通过 dlq 命令重新处理
+type DeadLetter struct {
+	BaseModel `bson:",inline"`
+	Post      *Post  `bson:"post" json:"post"`         // 保存失败的文章
+	Error     string `bson:"error" json:"error"`       // 最后一次的错误
+	Attempts  int    `bson:"attempts" json:"attempts"` // 已尝试的次数
+}
+
+// ShortLink 短链接(mp.weixin.qq.com/s/<ID>)对应的文章
+type ShortLink struct {
+	BaseModel `bson:",inline"`
+	ShortID   string `bson:"shortId" json:"shortId"` // 短链接中的 ID
+	MsgBiz    string `bson:"msgBiz" json:"msgBiz"`
+	MsgMid    string `bson:"msgMid" json:"msgMid"`
+	MsgIdx    string `bson:"msgIdx" json:"msgIdx"`
 }
 
 // CommMsgInfo 文章基础信息
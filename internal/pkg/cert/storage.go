@@ -0,0 +1,235 @@
+package cert
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// 叶子证书剩余有效期小于该值时重新签发
+const renewBefore = 24 * time.Hour
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9.\-]`)
+
+// fingerprintName 由 Fingerprint 生成的目录名, 只清理这种格式的目录
+var fingerprintName = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Storage 是 MITM 叶子证书缓存, 实现了 goproxy.CertStorage 接口.
+// 内存中按 LRU 淘汰, 同一主机的并发请求只会签发一次证书;
+// 设置 dir 后证书会按 CA 指纹持久化到磁盘, 重启后可以直接复用.
+type Storage struct {
+	size  int
+	dir   string // 当前 CA 指纹对应的目录, 为空表示不持久化
+	mtx   sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	group singleflight.Group
+}
+
+type entry struct {
+	hostname string
+	cert     *tls.Certificate
+}
+
+// NewStorage 创建证书缓存. size 为内存中最多缓存的证书数, dir 为持久化目录.
+// 持久化目录下只保留当前 CA 指纹的子目录, 其它 CA 指纹的子目录会被清理, 名称不是指纹的文件和目录不受影响.
+func NewStorage(ca *tls.Certificate, size int, dir string) (*Storage, error) {
+	if size <= 0 {
+		return nil, errors.Errorf("证书缓存大小必须大于0: %d", size)
+	}
+
+	s := &Storage{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+
+	if dir == "" {
+		return s, nil
+	}
+
+	fingerprint := Fingerprint(ca)
+	if err := os.MkdirAll(filepath.Join(dir, fingerprint), 0o700); err != nil {
+		return nil, errors.Wrap(err, "创建证书缓存目录失败")
+	}
+
+	// CA 变更后旧证书全部失效
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "读取证书缓存目录失败")
+	}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == fingerprint || !fingerprintName.MatchString(e.Name()) {
+			continue
+		}
+		log.Infof("清理过期CA的证书缓存: %s", e.Name())
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			log.Warnf("清理证书缓存失败: %v", err)
+		}
+	}
+
+	s.dir = filepath.Join(dir, fingerprint)
+	return s, nil
+}
+
+// Fingerprint 返回 CA 证书的 SHA-256 指纹
+func Fingerprint(ca *tls.Certificate) string {
+	sum := sha256.Sum256(ca.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// Fetch 获取主机对应的证书, 缓存未命中时调用 gen 签发
+func (s *Storage) Fetch(hostname string, gen func() (*tls.Certificate, error)) (*tls.Certificate, error) {
+	if c := s.get(hostname); c != nil {
+		return c, nil
+	}
+
+	v, err, _ := s.group.Do(hostname, func() (interface{}, error) {
+		// 可能在等待期间已由其它协程写入
+		if c := s.get(hostname); c != nil {
+			return c, nil
+		}
+
+		if c := s.load(hostname); c != nil {
+			s.add(hostname, c)
+			return c, nil
+		}
+
+		c, err := gen()
+		if err != nil {
+			return nil, err
+		}
+
+		s.add(hostname, c)
+		s.save(hostname, c)
+
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*tls.Certificate), nil
+}
+
+// Len 返回内存中缓存的证书数
+func (s *Storage) Len() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.ll.Len()
+}
+
+func (s *Storage) get(hostname string) *tls.Certificate {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	el, ok := s.items[hostname]
+	if !ok {
+		return nil
+	}
+
+	c := el.Value.(*entry).cert
+	if expiring(c) {
+		s.ll.Remove(el)
+		delete(s.items, hostname)
+		return nil
+	}
+
+	s.ll.MoveToFront(el)
+	return c
+}
+
+func (s *Storage) add(hostname string, c *tls.Certificate) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if el, ok := s.items[hostname]; ok {
+		el.Value.(*entry).cert = c
+		s.ll.MoveToFront(el)
+		return
+	}
+
+	s.items[hostname] = s.ll.PushFront(&entry{hostname: hostname, cert: c})
+
+	for s.ll.Len() > s.size {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*entry).hostname)
+	}
+}
+
+func (s *Storage) path(hostname string) string {
+	return filepath.Join(s.dir, unsafeFileChars.ReplaceAllString(hostname, "_")+".pem")
+}
+
+// load 从磁盘读取证书, 不存在、损坏或即将过期时返回 nil
+func (s *Storage) load(hostname string) *tls.Certificate {
+	if s.dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path(hostname))
+	if err != nil {
+		return nil
+	}
+
+	c, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		log.Warnf("解析缓存证书失败 %s: %v", hostname, err)
+		return nil
+	}
+	if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+		return nil
+	}
+	if expiring(&c) || c.Leaf.VerifyHostname(hostname) != nil {
+		return nil
+	}
+
+	return &c
+}
+
+// save 将证书写入磁盘, 失败只记录日志
+func (s *Storage) save(hostname string, c *tls.Certificate) {
+	if s.dir == "" {
+		return
+	}
+
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(c.PrivateKey)
+	if err != nil {
+		log.Warnf("序列化证书私钥失败 %s: %v", hostname, err)
+		return
+	}
+
+	var data []byte
+	for _, der := range c.Certificate {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})...)
+
+	// 先写临时文件再改名, 避免并发读到半个文件
+	tmp := s.path(hostname) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		log.Warnf("写入证书缓存失败 %s: %v", hostname, err)
+		return
+	}
+	if err := os.Rename(tmp, s.path(hostname)); err != nil {
+		log.Warnf("写入证书缓存失败 %s: %v", hostname, err)
+	}
+}
+
+func expiring(c *tls.Certificate) bool {
+	return c.Leaf != nil && time.Now().Add(renewBefore).After(c.Leaf.NotAfter)
+}
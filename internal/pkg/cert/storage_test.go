@@ -0,0 +1,150 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCA(t *testing.T) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour * 365),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func signer(t *testing.T, ca *tls.Certificate, hostname string, calls *int32) func() (*tls.Certificate, error) {
+	return func() (*tls.Certificate, error) {
+		atomic.AddInt32(calls, 1)
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: hostname},
+			DNSNames:     []string{hostname},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour * 30),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, key.Public(), ca.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.Certificate{Certificate: [][]byte{der, ca.Certificate[0]}, PrivateKey: key, Leaf: leaf}, nil
+	}
+}
+
+func TestStorageSingleflight(t *testing.T) {
+	ca := newTestCA(t)
+	s, err := NewStorage(ca, 10, "")
+	require.NoError(t, err)
+
+	var calls int32
+	gen := signer(t, ca, "mp.weixin.qq.com", &calls)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Fetch("mp.weixin.qq.com", gen)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestStorageEviction(t *testing.T) {
+	ca := newTestCA(t)
+	s, err := NewStorage(ca, 2, "")
+	require.NoError(t, err)
+
+	var calls int32
+	for _, host := range []string{"a.example.com", "b.example.com", "a.example.com", "c.example.com"} {
+		_, err := s.Fetch(host, signer(t, ca, host, &calls))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, s.Len())
+	assert.Equal(t, int32(3), calls)
+
+	// b 最久未使用, 已被淘汰
+	_, err = s.Fetch("b.example.com", signer(t, ca, "b.example.com", &calls))
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), calls)
+}
+
+func TestStoragePersistence(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+
+	// 与其它数据共用目录时, 名称不是指纹的目录不会被清理
+	other := filepath.Join(dir, "har")
+	require.NoError(t, os.MkdirAll(other, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(other, "capture.har"), []byte("{}"), 0o600))
+
+	var calls int32
+	s, err := NewStorage(ca, 10, dir)
+	require.NoError(t, err)
+	first, err := s.Fetch("mp.weixin.qq.com", signer(t, ca, "mp.weixin.qq.com", &calls))
+	require.NoError(t, err)
+
+	// 重启后复用磁盘上的证书
+	s, err = NewStorage(ca, 10, dir)
+	require.NoError(t, err)
+	second, err := s.Fetch("mp.weixin.qq.com", signer(t, ca, "mp.weixin.qq.com", &calls))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls)
+	assert.Equal(t, first.Certificate[0], second.Certificate[0])
+
+	// 更换CA后旧证书失效
+	otherCA := newTestCA(t)
+	s, err = NewStorage(otherCA, 10, dir)
+	require.NoError(t, err)
+	_, err = s.Fetch("mp.weixin.qq.com", signer(t, otherCA, "mp.weixin.qq.com", &calls))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls)
+
+	_, err = os.Stat(filepath.Join(dir, Fingerprint(ca)))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(other, "capture.har"))
+	assert.NoError(t, err)
+}
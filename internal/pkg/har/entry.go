@@ -0,0 +1,119 @@
+package har
+
+import (
+	"encoding/base64"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+// NewEntry 根据请求和响应构建 HAR 条目, reqBody 和 respBody 为已解码的请求体和响应体
+func NewEntry(started time.Time, req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) Entry {
+	elapsed := float64(time.Since(started).Microseconds()) / 1000
+
+	entry := Entry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            elapsed,
+		Request: Request{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Cookies:     cookies(req.Cookies()),
+			Headers:     headers(req.Header),
+			QueryString: []NameValue{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Response: Response{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Cookies:     cookies(resp.Cookies()),
+			Headers:     headers(resp.Header),
+			RedirectURL: resp.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(respBody),
+		},
+		Timings: Timings{Send: -1, Wait: elapsed, Receive: -1},
+	}
+
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, NameValue{Name: name, Value: v})
+		}
+	}
+
+	if len(reqBody) > 0 {
+		text, encoding := encodeBody(reqBody)
+		entry.Request.PostData = &PostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		}
+	}
+
+	text, encoding := encodeBody(respBody)
+	entry.Response.Content = Content{
+		Size:     len(respBody),
+		MimeType: resp.Header.Get("Content-Type"),
+		Text:     text,
+		Encoding: encoding,
+	}
+
+	return entry
+}
+
+// RequestBody 返回解码后的请求体
+func (e *Entry) RequestBody() ([]byte, error) {
+	if e.Request.PostData == nil {
+		return nil, nil
+	}
+	return decodeBody(e.Request.PostData.Text, e.Request.PostData.Encoding)
+}
+
+// ResponseBody 返回解码后的响应体
+func (e *Entry) ResponseBody() ([]byte, error) {
+	return decodeBody(e.Response.Content.Text, e.Response.Content.Encoding)
+}
+
+// RequestHeader 返回第一个同名请求头的值
+func (e *Entry) RequestHeader(name string) string {
+	for _, h := range e.Request.Headers {
+		if http.CanonicalHeaderKey(h.Name) == http.CanonicalHeaderKey(name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func encodeBody(body []byte) (text string, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeBody(text string, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+func headers(h http.Header) []NameValue {
+	list := []NameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			list = append(list, NameValue{Name: name, Value: v})
+		}
+	}
+	return list
+}
+
+func cookies(cs []*http.Cookie) []NameValue {
+	list := []NameValue{}
+	for _, c := range cs {
+		list = append(list, NameValue{Name: c.Name, Value: c.Value})
+	}
+	return list
+}
@@ -0,0 +1,95 @@
+package har
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEntry(t *testing.T) Entry {
+	req := httptest.NewRequest(http.MethodGet,
+		"https://mp.weixin.qq.com/mp/profile_ext?action=home&__biz=MzA5&key=abc&pass_ticket=def", nil)
+	req.Header.Set("Cookie", "wap_sid2=secret")
+	req.Header.Set("X-Wechat-Key", "secret")
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+	}
+	body := []byte(`<script>var pass_ticket = "def"; var link = "/s?__biz=MzA5&uin=123&key=abc";</script>`)
+
+	return NewEntry(time.Now(), req, nil, resp, body)
+}
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactor([]string{"key", "pass_ticket", "uin"}, []string{"X-Wechat-Key"},
+		[]string{`pass_ticket\s*=\s*"([^"]*)"`})
+	require.NoError(t, err)
+
+	e := newTestEntry(t)
+	r.Apply(&e)
+
+	assert.NotContains(t, e.Request.URL, "abc")
+	assert.NotContains(t, e.Request.URL, "def")
+	assert.Contains(t, e.Request.URL, "__biz=MzA5")
+	assert.Equal(t, Redacted, e.RequestHeader("Cookie"))
+	assert.Equal(t, Redacted, e.RequestHeader("X-Wechat-Key"))
+	assert.Equal(t, `<script>var pass_ticket = "REDACTED"; var link = "/s?__biz=MzA5&uin=REDACTED&key=REDACTED";</script>`,
+		e.Response.Content.Text)
+
+	_, err = NewRedactor(nil, nil, []string{`no group`})
+	assert.Error(t, err)
+}
+
+func TestRecorderRotateAndLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	rec, err := NewRecorder(dir, 1, 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, rec.Record(newTestEntry(t)))
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, rec.Record(newTestEntry(t)))
+	require.NoError(t, rec.Close())
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.har"))
+	assert.Len(t, files, 2)
+
+	entries, err := LoadPath(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	body, err := entries[0].ResponseBody()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(body), "<script>"))
+}
+
+func TestLoadUnterminated(t *testing.T) {
+	dir := t.TempDir()
+
+	rec, err := NewRecorder(dir, 0, 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, rec.Record(newTestEntry(t)))
+
+	// 模拟进程异常退出, 文件没有结尾
+	files, _ := filepath.Glob(filepath.Join(dir, "*.har"))
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.False(t, strings.HasSuffix(string(data), fileFooter))
+
+	h, err := Load(files[0])
+	require.NoError(t, err)
+	assert.Len(t, h.Log.Entries, 1)
+	assert.Equal(t, "1.2", h.Log.Version)
+}
@@ -0,0 +1,59 @@
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/marmotedu/errors"
+)
+
+// Load 读取 HAR 文件, 兼容录制中途退出、没有结尾的文件
+func Load(path string) (*HAR, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "读取HAR文件失败: %s", path)
+	}
+
+	var h HAR
+	if err = json.Unmarshal(data, &h); err == nil {
+		return &h, nil
+	}
+
+	// 尝试补全未关闭的文件
+	fixed := append(bytes.TrimRight(data, ",\n\r\t "), []byte(fileFooter)...)
+	if json.Unmarshal(fixed, &h) == nil {
+		return &h, nil
+	}
+
+	return nil, errors.Wrapf(err, "解析HAR文件失败: %s", path)
+}
+
+// LoadPath 读取 HAR 文件或目录下的所有 .har 文件, 按文件名顺序合并条目
+func LoadPath(path string) ([]Entry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "读取HAR路径失败: %s", path)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.har")); err != nil {
+			return nil, errors.Wrapf(err, "读取HAR目录失败: %s", path)
+		}
+		sort.Strings(files)
+	}
+
+	var entries []Entry
+	for _, f := range files {
+		h, err := Load(f)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, h.Log.Entries...)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,147 @@
+package har
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+)
+
+const (
+	creatorName    = "wx-backup"
+	creatorVersion = "1.0"
+	fileFooter     = "\n]}}\n"
+)
+
+// Recorder 将 HAR 条目流式写入文件, 按大小和时间轮转.
+// 文件在关闭或轮转时才补全结尾, 进程异常退出留下的文件可以由 Load 读取.
+type Recorder struct {
+	dir      string
+	maxSize  int64
+	maxAge   time.Duration
+	redactor *Redactor
+
+	mtx      sync.Mutex
+	file     *os.File
+	size     int64
+	count    int
+	openedAt time.Time
+}
+
+// NewRecorder 创建录制器. maxSize 为单个文件的最大字节数, maxAge 为单个文件的最长写入时间, 为 0 表示不限制
+func NewRecorder(dir string, maxSize int64, maxAge time.Duration, redactor *Redactor) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "创建HAR目录失败")
+	}
+
+	return &Recorder{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		redactor: redactor,
+	}, nil
+}
+
+// Record 脱敏并写入一条记录
+func (r *Recorder) Record(e Entry) error {
+	if r.redactor != nil {
+		r.redactor.Apply(&e)
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "序列化HAR条目失败")
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.file != nil && r.shouldRotate(int64(len(data))) {
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+	}
+
+	if r.file == nil {
+		if err := r.openFile(); err != nil {
+			return err
+		}
+	}
+
+	if r.count > 0 {
+		data = append([]byte(",\n"), data...)
+	}
+
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "写入HAR文件失败")
+	}
+	r.count++
+
+	return nil
+}
+
+// Close 补全当前文件并关闭
+func (r *Recorder) Close() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	return r.closeFile()
+}
+
+func (r *Recorder) shouldRotate(next int64) bool {
+	if r.count == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+next > r.maxSize {
+		return true
+	}
+	if r.maxAge > 0 && time.Since(r.openedAt) > r.maxAge {
+		return true
+	}
+	return false
+}
+
+func (r *Recorder) openFile() error {
+	now := time.Now()
+	name := filepath.Join(r.dir, now.Format("20060102-150405.000")+".har")
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "创建HAR文件失败")
+	}
+
+	header := fmt.Sprintf(`{"log":{"version":"1.2","creator":{"name":%q,"version":%q},"entries":[`+"\n",
+		creatorName, creatorVersion)
+	n, err := f.WriteString(header)
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "写入HAR文件失败")
+	}
+
+	r.file = f
+	r.size = int64(n)
+	r.count = 0
+	r.openedAt = now
+	log.Infof("开始录制HAR文件: %s", name)
+
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	_, err := r.file.WriteString(fileFooter)
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	return errors.Wrap(err, "关闭HAR文件失败")
+}
@@ -0,0 +1,143 @@
+package har
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/marmotedu/errors"
+)
+
+// Redacted 脱敏后的占位值
+const Redacted = "REDACTED"
+
+// Redactor 在写入 HAR 前脱敏会话凭据
+type Redactor struct {
+	params  map[string]bool
+	headers map[string]bool
+	// 正文中的 "参数=值" 形式, 覆盖页面里拼接的链接
+	inline *regexp.Regexp
+	// 用户配置的正文规则, 第一个捕获组会被替换
+	body []*regexp.Regexp
+}
+
+// NewRedactor 创建脱敏器. params 为需要脱敏的查询参数, headers 为需要脱敏的请求/响应头,
+// bodyPatterns 为正文的正则规则, 每条规则中的第一个捕获组会被替换. cookie 总是会被脱敏.
+func NewRedactor(params, headers, bodyPatterns []string) (*Redactor, error) {
+	r := &Redactor{
+		params:  make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+
+	var quoted []string
+	for _, p := range params {
+		r.params[p] = true
+		quoted = append(quoted, regexp.QuoteMeta(p))
+	}
+	if len(quoted) > 0 {
+		r.inline = regexp.MustCompile(`\b(` + strings.Join(quoted, "|") + `)=([^&"'\s<>\\]+)`)
+	}
+
+	for _, h := range headers {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+
+	for _, p := range bodyPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "解析脱敏规则失败: %s", p)
+		}
+		if re.NumSubexp() < 1 {
+			return nil, errors.Errorf("脱敏规则缺少捕获组: %s", p)
+		}
+		r.body = append(r.body, re)
+	}
+
+	return r, nil
+}
+
+// Apply 脱敏 HAR 条目
+func (r *Redactor) Apply(e *Entry) {
+	e.Request.URL = r.URL(e.Request.URL)
+	for i, q := range e.Request.QueryString {
+		if r.params[q.Name] {
+			e.Request.QueryString[i].Value = Redacted
+		}
+	}
+
+	r.nameValues(e.Request.Headers)
+	r.nameValues(e.Response.Headers)
+	redactAll(e.Request.Cookies)
+	redactAll(e.Response.Cookies)
+
+	if e.Request.PostData != nil && e.Request.PostData.Encoding == "" {
+		e.Request.PostData.Text = r.Text(e.Request.PostData.Text)
+	}
+	if e.Response.Content.Encoding == "" {
+		e.Response.Content.Text = r.Text(e.Response.Content.Text)
+	}
+	if e.Response.RedirectURL != "" {
+		e.Response.RedirectURL = r.URL(e.Response.RedirectURL)
+	}
+}
+
+// URL 脱敏链接中的查询参数
+func (r *Redactor) URL(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return r.Text(link)
+	}
+
+	query := u.Query()
+	changed := false
+	for name := range query {
+		if r.params[name] {
+			query.Set(name, Redacted)
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// Text 脱敏正文
+func (r *Redactor) Text(text string) string {
+	if r.inline != nil {
+		text = r.inline.ReplaceAllString(text, "${1}="+Redacted)
+	}
+
+	for _, re := range r.body {
+		text = re.ReplaceAllStringFunc(text, func(match string) string {
+			loc := re.FindStringSubmatchIndex(match)
+			if loc[2] < 0 {
+				return match
+			}
+			return match[:loc[2]] + Redacted + match[loc[3]:]
+		})
+	}
+
+	return text
+}
+
+func (r *Redactor) nameValues(list []NameValue) {
+	for i, h := range list {
+		name := http.CanonicalHeaderKey(h.Name)
+		switch {
+		case name == "Cookie" || name == "Set-Cookie":
+			list[i].Value = Redacted
+		case r.headers[name]:
+			list[i].Value = Redacted
+		case name == "Referer" || name == "Location":
+			list[i].Value = r.URL(h.Value)
+		}
+	}
+}
+
+func redactAll(list []NameValue) {
+	for i := range list {
+		list[i].Value = Redacted
+	}
+}
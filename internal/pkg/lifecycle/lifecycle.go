@@ -0,0 +1,112 @@
+// Package lifecycle 按顺序启动和关闭应用的各个组件: 启动按注册顺序, 关闭按相反顺序,
+// 每个阶段有独立的超时, 一个阶段失败或超时不影响后续阶段的关闭.
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+)
+
+// Hook 一个组件的启动和关闭函数, 任一函数可以为空
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+	// 启动和关闭的超时, 为 0 时使用 Lifecycle 的默认超时
+	StartTimeout time.Duration
+	StopTimeout  time.Duration
+}
+
+// Lifecycle 组件生命周期管理
+type Lifecycle struct {
+	timeout time.Duration
+
+	mtx     sync.Mutex
+	hooks   []Hook
+	started []Hook
+}
+
+// New 创建生命周期管理, timeout 为每个阶段的默认超时
+func New(timeout time.Duration) *Lifecycle {
+	return &Lifecycle{timeout: timeout}
+}
+
+// Append 注册组件, 关闭时先关闭后注册的组件
+func (l *Lifecycle) Append(hooks ...Hook) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.hooks = append(l.hooks, hooks...)
+}
+
+// Start 按注册顺序启动组件. 某个组件启动失败时关闭已经启动的组件, 返回启动错误
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mtx.Lock()
+	hooks := l.hooks[len(l.started):]
+	l.mtx.Unlock()
+
+	for _, h := range hooks {
+		if h.Start != nil {
+			if err := l.run(ctx, h.Name, "启动", h.StartTimeout, h.Start); err != nil {
+				if stopErr := l.Stop(context.Background()); stopErr != nil {
+					log.Warnf("启动失败后关闭组件出错: %v", stopErr)
+				}
+				return err
+			}
+		}
+
+		l.mtx.Lock()
+		l.started = append(l.started, h)
+		l.mtx.Unlock()
+		log.Infof("已启动: %s", h.Name)
+	}
+	return nil
+}
+
+// Stop 按相反顺序关闭已经启动的组件, 汇总各阶段的错误. ctx 取消后剩余阶段仍会执行, 但不再等待
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.mtx.Lock()
+	started := l.started
+	l.started = nil
+	l.mtx.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		h := started[i]
+		if h.Stop == nil {
+			continue
+		}
+
+		log.Infof("正在关闭: %s", h.Name)
+		if err := l.run(ctx, h.Name, "关闭", h.StopTimeout, h.Stop); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.NewAggregate(errs)
+}
+
+// run 在超时内执行 fn. 超时后不再等待 fn 返回
+func (l *Lifecycle) run(ctx context.Context, name, action string, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout <= 0 {
+		timeout = l.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return errors.Wrapf(err, "%s%s失败", action, name)
+		}
+		return nil
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "%s%s超时", action, name)
+	}
+}
@@ -0,0 +1,78 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder []string
+
+func (r *recorder) hook(name string, startErr, stopErr error) Hook {
+	return Hook{
+		Name: name,
+		Start: func(context.Context) error {
+			*r = append(*r, "start "+name)
+			return startErr
+		},
+		Stop: func(context.Context) error {
+			*r = append(*r, "stop "+name)
+			return stopErr
+		},
+	}
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	var r recorder
+	l := New(time.Second)
+	l.Append(r.hook("store", nil, nil), r.hook("queue", nil, errors.New("boom")), r.hook("proxy", nil, nil))
+
+	require.NoError(t, l.Start(context.Background()))
+	err := l.Stop(context.Background())
+
+	// 关闭失败不影响后续阶段
+	assert.ErrorContains(t, err, "关闭queue失败")
+	assert.Equal(t, recorder{"start store", "start queue", "start proxy", "stop proxy", "stop queue", "stop store"}, r)
+
+	// 重复关闭不再执行
+	assert.NoError(t, l.Stop(context.Background()))
+}
+
+func TestLifecycleStartFailure(t *testing.T) {
+	var r recorder
+	l := New(time.Second)
+	l.Append(r.hook("store", nil, nil), r.hook("queue", errors.New("boom"), nil), r.hook("proxy", nil, nil))
+
+	err := l.Start(context.Background())
+	assert.ErrorContains(t, err, "启动queue失败")
+	// 只关闭已经启动的组件
+	assert.Equal(t, recorder{"start store", "start queue", "stop store"}, r)
+}
+
+func TestLifecycleTimeout(t *testing.T) {
+	var r recorder
+	l := New(time.Second)
+	l.Append(r.hook("store", nil, nil), Hook{
+		Name:        "workers",
+		StopTimeout: 10 * time.Millisecond,
+		Stop: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	require.NoError(t, l.Start(context.Background()))
+
+	start := time.Now()
+	err := l.Stop(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.ErrorContains(t, err, "关闭workers超时")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// 超时的阶段之后继续关闭
+	assert.Equal(t, recorder{"start store", "stop store"}, r)
+}
@@ -0,0 +1,135 @@
+// Package migrate 按版本号顺序执行数据库迁移, 并记录已经执行的版本.
+// 多个实例可能同时执行同一个迁移, 迁移函数需要能够重复执行.
+package migrate
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/marmotedu/errors"
+)
+
+// ErrApplied 该版本已经被其它实例记录
+var ErrApplied = errors.New("迁移已执行")
+
+// Migration 一个数据库迁移
+type Migration struct {
+	// Version 版本号, 从 1 开始递增, 发布后不能修改
+	Version     int
+	Description string
+	Up          func(ctx context.Context) error
+}
+
+// Record 已执行的迁移
+type Record struct {
+	Version     int       `bson:"_id" json:"version"`
+	Description string    `bson:"description" json:"description"`
+	AppliedAt   time.Time `bson:"appliedAt" json:"appliedAt"`
+}
+
+// History 保存已执行的迁移
+type History interface {
+	// Applied 返回已执行的迁移
+	Applied(ctx context.Context) ([]Record, error)
+	// Add 记录执行完成的迁移, 版本已存在时返回 ErrApplied
+	Add(ctx context.Context, record Record) error
+}
+
+// State 迁移的执行状态
+type State struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// Runner 迁移执行器
+type Runner struct {
+	history    History
+	migrations []Migration
+}
+
+// New 创建迁移执行器, 版本号必须为正数且不能重复
+func New(history History, migrations ...Migration) (*Runner, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, errors.Errorf("迁移版本号必须为正数: %d", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, errors.Errorf("迁移版本号重复: %d", m.Version)
+		}
+		if m.Up == nil {
+			return nil, errors.Errorf("迁移 %d 缺少执行函数", m.Version)
+		}
+	}
+
+	return &Runner{history: history, migrations: sorted}, nil
+}
+
+// Status 返回所有迁移的执行状态, 按版本号排序
+func (r *Runner) Status(ctx context.Context) ([]State, error) {
+	records, err := r.history.Applied(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "读取迁移记录失败")
+	}
+
+	applied := make(map[int]Record, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	states := make([]State, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		record, ok := applied[m.Version]
+		states = append(states, State{
+			Version:     m.Version,
+			Description: m.Description,
+			Applied:     ok,
+			AppliedAt:   record.AppliedAt,
+		})
+	}
+	return states, nil
+}
+
+// Pending 返回尚未执行的迁移
+func (r *Runner) Pending(ctx context.Context) ([]Migration, error) {
+	states, err := r.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for i, s := range states {
+		if !s.Applied {
+			pending = append(pending, r.migrations[i])
+		}
+	}
+	return pending, nil
+}
+
+// Up 按版本号顺序执行尚未执行的迁移, 遇到错误时停止, 返回已执行的迁移
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	pending, err := r.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range pending {
+		if err := m.Up(ctx); err != nil {
+			return done, errors.Wrapf(err, "执行迁移 %d (%s) 失败", m.Version, m.Description)
+		}
+
+		err := r.history.Add(ctx, Record{Version: m.Version, Description: m.Description, AppliedAt: time.Now()})
+		if err != nil && !errors.Is(err, ErrApplied) {
+			return done, errors.Wrapf(err, "记录迁移 %d 失败", m.Version)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
@@ -0,0 +1,117 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryHistory struct {
+	records []Record
+}
+
+func (h *memoryHistory) Applied(context.Context) ([]Record, error) {
+	return h.records, nil
+}
+
+func (h *memoryHistory) Add(_ context.Context, record Record) error {
+	for _, r := range h.records {
+		if r.Version == record.Version {
+			return ErrApplied
+		}
+	}
+	h.records = append(h.records, record)
+	return nil
+}
+
+func step(version int, ran *[]int, err error) Migration {
+	return Migration{
+		Version:     version,
+		Description: "step",
+		Up: func(context.Context) error {
+			*ran = append(*ran, version)
+			return err
+		},
+	}
+}
+
+func TestRunnerUp(t *testing.T) {
+	var ran []int
+	history := &memoryHistory{records: []Record{{Version: 1}}}
+	runner, err := New(history, step(3, &ran, nil), step(1, &ran, nil), step(2, &ran, nil))
+	require.NoError(t, err)
+
+	pending, err := runner.Pending(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	// 按版本号顺序执行, 跳过已执行的迁移
+	done, err := runner.Up(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, done, 2)
+	assert.Equal(t, []int{2, 3}, ran)
+
+	states, err := runner.Status(context.Background())
+	require.NoError(t, err)
+	for _, s := range states {
+		assert.True(t, s.Applied, s.Version)
+	}
+
+	// 再次执行不做任何事
+	done, err = runner.Up(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, done)
+	assert.Equal(t, []int{2, 3}, ran)
+}
+
+func TestRunnerStopsOnError(t *testing.T) {
+	var ran []int
+	history := &memoryHistory{}
+	runner, err := New(history, step(1, &ran, nil), step(2, &ran, errors.New("boom")), step(3, &ran, nil))
+	require.NoError(t, err)
+
+	done, err := runner.Up(context.Background())
+	assert.ErrorContains(t, err, "执行迁移 2 (step) 失败")
+	assert.Len(t, done, 1)
+	assert.Equal(t, []int{1, 2}, ran)
+
+	// 失败的迁移不记录, 下次重新执行
+	states, err := runner.Status(context.Background())
+	require.NoError(t, err)
+	assert.True(t, states[0].Applied)
+	assert.False(t, states[1].Applied)
+	assert.False(t, states[2].Applied)
+}
+
+func TestRunnerAppliedConcurrently(t *testing.T) {
+	var ran []int
+	history := &memoryHistory{}
+	m := step(1, &ran, nil)
+	up := m.Up
+	// 执行期间其它实例已经记录了该版本
+	m.Up = func(ctx context.Context) error {
+		history.records = append(history.records, Record{Version: 1})
+		return up(ctx)
+	}
+	runner, err := New(history, m)
+	require.NoError(t, err)
+
+	done, err := runner.Up(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, done, 1)
+}
+
+func TestNewValidatesVersions(t *testing.T) {
+	var ran []int
+	_, err := New(&memoryHistory{}, step(1, &ran, nil), step(1, &ran, nil))
+	assert.ErrorContains(t, err, "重复")
+
+	_, err = New(&memoryHistory{}, step(0, &ran, nil))
+	assert.ErrorContains(t, err, "正数")
+
+	_, err = New(&memoryHistory{}, Migration{Version: 1})
+	assert.ErrorContains(t, err, "缺少执行函数")
+}
@@ -0,0 +1,43 @@
+package migrate
+
+import (
+	"context"
+
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoHistory 将已执行的迁移保存在集合中, 版本号作为 _id
+type MongoHistory struct {
+	collection *mongo.Collection
+}
+
+// NewMongoHistory 创建保存在 collection 中的迁移记录
+func NewMongoHistory(collection *mongo.Collection) *MongoHistory {
+	return &MongoHistory{collection: collection}
+}
+
+// Applied 返回已执行的迁移, 按版本号排序
+func (h *MongoHistory) Applied(ctx context.Context) ([]Record, error) {
+	cursor, err := h.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Add 记录执行完成的迁移
+func (h *MongoHistory) Add(ctx context.Context, record Record) error {
+	_, err := h.collection.InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.Wrapf(ErrApplied, "版本 %d", record.Version)
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package mongo
 
 import (
 	"context"
+	"github.com/marmotedu/errors"
 	"github.com/marmotedu/log"
 	"sync"
 	"time"
@@ -28,52 +29,70 @@ type DB struct {
 
 var (
 	instance *DB
-	once     sync.Once
+	mtx      sync.Mutex
 )
 
 // GetMongoDB 获取MongoDB实例
 func GetMongoDB() *DB {
+	mtx.Lock()
+	defer mtx.Unlock()
+
 	if instance == nil {
 		log.Fatal("MongoDB未初始化")
 	}
 	return instance
 }
 
-// InitMongoDB 初始化MongoDB连接
+// InitMongoDB 初始化MongoDB连接. 已经连接时直接返回, 连接失败后可以再次调用
 func InitMongoDB(config Config) error {
-	var err error
+	mtx.Lock()
+	defer mtx.Unlock()
 
-	once.Do(func() {
-		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
-		defer cancel()
+	if instance != nil {
+		return nil
+	}
 
-		// 配置连接选项
-		opts := options.Client().
-			ApplyURI(config.URI).
-			SetMaxPoolSize(config.MaxPoolSize).
-			SetMinPoolSize(config.MinPoolSize).
-			SetMaxConnIdleTime(config.MaxIdleTime).
-			SetRetryWrites(config.RetryWrites).
-			SetRetryReads(config.RetryReads)
-
-		// 连接MongoDB
-		client, err := mongo.Connect(ctx, opts)
-		if err != nil {
-			return
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
 
-		// 测试连接
-		if err = client.Ping(ctx, nil); err != nil {
-			return
-		}
+	// 连接MongoDB
+	client, err := mongo.Connect(ctx, clientOptions(config))
+	if err != nil {
+		return errors.Wrap(err, "连接MongoDB失败")
+	}
 
-		instance = &DB{
-			client:   client,
-			database: client.Database(config.Database),
-		}
-	})
+	// 测试连接
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		return errors.Wrap(err, "MongoDB连接测试失败")
+	}
+
+	instance = &DB{
+		client:   client,
+		database: client.Database(config.Database),
+	}
+	return nil
+}
 
-	return err
+// clientOptions 返回连接选项, 连接串中已有的参数优先, 没有设置的参数使用 config 中的值
+func clientOptions(config Config) *options.ClientOptions {
+	opts := options.Client().ApplyURI(config.URI)
+	if opts.MaxPoolSize == nil {
+		opts.SetMaxPoolSize(config.MaxPoolSize)
+	}
+	if opts.MinPoolSize == nil {
+		opts.SetMinPoolSize(config.MinPoolSize)
+	}
+	if opts.MaxConnIdleTime == nil {
+		opts.SetMaxConnIdleTime(config.MaxIdleTime)
+	}
+	if opts.RetryWrites == nil {
+		opts.SetRetryWrites(config.RetryWrites)
+	}
+	if opts.RetryReads == nil {
+		opts.SetRetryReads(config.RetryReads)
+	}
+	return opts
 }
 
 // Collection 获取集合
@@ -81,8 +100,14 @@ func (m *DB) Collection(name string) *mongo.Collection {
 	return m.database.Collection(name)
 }
 
-// Close 关闭连接
+// Close 关闭连接, 关闭后可以重新初始化
 func (m *DB) Close() {
+	mtx.Lock()
+	if instance == m {
+		instance = nil
+	}
+	mtx.Unlock()
+
 	if m.client != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
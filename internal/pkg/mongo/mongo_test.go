@@ -0,0 +1,38 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientOptionsURIPrecedence(t *testing.T) {
+	config := Config{
+		MaxPoolSize: 100,
+		MinPoolSize: 10,
+		MaxIdleTime: 30 * time.Second,
+		RetryWrites: true,
+		RetryReads:  true,
+	}
+
+	// 连接串中的参数优先
+	config.URI = "mongodb://localhost:27017/?maxPoolSize=5&minPoolSize=1&maxIdleTimeMS=1000&retryWrites=false&retryReads=false"
+	opts := clientOptions(config)
+	require.NoError(t, opts.Validate())
+	assert.EqualValues(t, 5, *opts.MaxPoolSize)
+	assert.EqualValues(t, 1, *opts.MinPoolSize)
+	assert.Equal(t, time.Second, *opts.MaxConnIdleTime)
+	assert.False(t, *opts.RetryWrites)
+	assert.False(t, *opts.RetryReads)
+
+	// 连接串中没有的参数使用配置
+	config.URI = "mongodb://localhost:27017/?maxPoolSize=5"
+	opts = clientOptions(config)
+	assert.EqualValues(t, 5, *opts.MaxPoolSize)
+	assert.EqualValues(t, 10, *opts.MinPoolSize)
+	assert.Equal(t, 30*time.Second, *opts.MaxConnIdleTime)
+	assert.True(t, *opts.RetryWrites)
+	assert.True(t, *opts.RetryReads)
+}
@@ -0,0 +1,144 @@
+package options
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"wechat-backup/internal/model"
+)
+
+// CaptureOptions 包含声明式抓取规则的配置选项
+type CaptureOptions struct {
+	Rules []CaptureRule `json:"rules" mapstructure:"rules"`
+}
+
+// CaptureRule 声明式抓取规则: 匹配请求, 从响应中提取记录并按 upsert 键写入指定集合
+type CaptureRule struct {
+	Name     string        `json:"name"     mapstructure:"name"`
+	Priority int           `json:"priority" mapstructure:"priority"`
+	Timeout  time.Duration `json:"timeout"  mapstructure:"timeout"`
+
+	// 匹配条件, 均为空时不限制
+	Host   string `json:"host"   mapstructure:"host"`   // 主机, 支持 glob 通配符
+	Path   string `json:"path"   mapstructure:"path"`   // 路径, 支持 glob 通配符
+	Method string `json:"method" mapstructure:"method"` // 请求方法
+	// 查询参数, 值为 "*" 时只要求参数存在
+	Query map[string]string `json:"query" mapstructure:"query"`
+	// 响应类型: json 或 html, 决定提取方式
+	ContentType string `json:"content-type" mapstructure:"content-type"`
+
+	// 记录选择器, json 为 JSONPath, html 为 CSS 选择器. 为空时整个响应是一条记录
+	Items string `json:"items" mapstructure:"items"`
+	// 字段提取规则
+	Fields []CaptureField `json:"fields" mapstructure:"fields"`
+
+	// 写入的集合和 upsert 键, 键必须是 Fields 中的字段. 不能使用 posts、profiles 等程序使用的集合
+	Collection string   `json:"collection"  mapstructure:"collection"`
+	UpsertKeys []string `json:"upsert-keys" mapstructure:"upsert-keys"`
+}
+
+// CaptureField 字段提取规则, 按 query、jsonpath、css、regex 的顺序取值:
+// regex 与 jsonpath/css 同时设置时作用于它们的结果, 否则作用于记录的原文
+type CaptureField struct {
+	Name     string `json:"name"     mapstructure:"name"`
+	Query    string `json:"query"    mapstructure:"query"`    // 请求的查询参数
+	JSONPath string `json:"jsonpath" mapstructure:"jsonpath"` // 相对于记录的 JSONPath
+	CSS      string `json:"css"      mapstructure:"css"`      // 相对于记录的 CSS 选择器
+	Attr     string `json:"attr"     mapstructure:"attr"`     // CSS 取属性值, 为空时取文本
+	Regex    string `json:"regex"    mapstructure:"regex"`    // 正则, 取第一个捕获组
+	Required bool   `json:"required" mapstructure:"required"` // 为空时跳过整条记录, upsert 键总是必填
+}
+
+// reservedCaptureFields 保存记录时由程序写入的字段, 规则不能定义同名字段
+var reservedCaptureFields = map[string]bool{
+	model.FieldID:         true,
+	model.FieldCreatedAt:  true,
+	model.FieldUpdatedAt:  true,
+	model.FieldCapturedBy: true,
+}
+
+// NewCaptureOptions 创建一个带有默认值的 CaptureOptions
+func NewCaptureOptions() *CaptureOptions {
+	return &CaptureOptions{}
+}
+
+// Validate 验证声明式抓取规则是否合法
+func (o *CaptureOptions) Validate() []error {
+	var errs []error
+
+	names := make(map[string]bool)
+	for i := range o.Rules {
+		r := &o.Rules[i]
+		prefix := fmt.Sprintf("capture rules[%d]", i)
+		if r.Name != "" {
+			prefix = fmt.Sprintf("capture rule %s", r.Name)
+		}
+
+		if r.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: name不能为空", prefix))
+		} else if names[r.Name] {
+			errs = append(errs, fmt.Errorf("%s: name重复", prefix))
+		}
+		names[r.Name] = true
+
+		for _, pattern := range []string{r.Host, r.Path} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s: 通配符格式错误: %q", prefix, pattern))
+			}
+		}
+
+		switch strings.ToLower(r.ContentType) {
+		case "json", "html":
+		default:
+			errs = append(errs, fmt.Errorf("%s: content-type只支持json或html: %q", prefix, r.ContentType))
+		}
+
+		if r.Collection == "" {
+			errs = append(errs, fmt.Errorf("%s: collection不能为空", prefix))
+		} else if model.IsReservedCollection(r.Collection) {
+			errs = append(errs, fmt.Errorf("%s: collection %s由程序使用, 请换一个集合名", prefix, r.Collection))
+		}
+		if len(r.Fields) == 0 {
+			errs = append(errs, fmt.Errorf("%s: fields不能为空", prefix))
+		}
+
+		fields := make(map[string]bool)
+		for _, f := range r.Fields {
+			switch {
+			case f.Name == "":
+				errs = append(errs, fmt.Errorf("%s: field name不能为空", prefix))
+			case strings.HasPrefix(f.Name, "$") || strings.Contains(f.Name, "."):
+				errs = append(errs, fmt.Errorf("%s: field %s不能以$开头或包含.", prefix, f.Name))
+			case reservedCaptureFields[f.Name]:
+				errs = append(errs, fmt.Errorf("%s: field %s由程序写入, 请换一个字段名", prefix, f.Name))
+			}
+			fields[f.Name] = true
+
+			if f.Query == "" && f.JSONPath == "" && f.CSS == "" && f.Regex == "" {
+				errs = append(errs, fmt.Errorf("%s: field %s缺少提取规则", prefix, f.Name))
+			}
+			if f.Regex != "" {
+				re, err := regexp.Compile(f.Regex)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: field %s正则格式错误", prefix, f.Name))
+				} else if re.NumSubexp() < 1 {
+					errs = append(errs, fmt.Errorf("%s: field %s正则缺少捕获组", prefix, f.Name))
+				}
+			}
+		}
+
+		if len(r.UpsertKeys) == 0 {
+			errs = append(errs, fmt.Errorf("%s: upsert-keys不能为空", prefix))
+		}
+		for _, k := range r.UpsertKeys {
+			if !fields[k] {
+				errs = append(errs, fmt.Errorf("%s: upsert-key %s不是已定义的字段", prefix, k))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,53 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureValidateCollection(t *testing.T) {
+	rule := CaptureRule{
+		Name:        "comments",
+		ContentType: "json",
+		Fields:      []CaptureField{{Name: "id", JSONPath: "$.id"}},
+		UpsertKeys:  []string{"id"},
+	}
+
+	for collection, valid := range map[string]bool{
+		"comments":          true,
+		"":                  false,
+		"posts":             false,
+		"dead_letters":      false,
+		"schema_migrations": false,
+		"system.profile":    false,
+	} {
+		o := NewCaptureOptions()
+		r := rule
+		r.Collection = collection
+		o.Rules = []CaptureRule{r}
+		assert.Equal(t, valid, len(o.Validate()) == 0, collection)
+	}
+}
+
+func TestCaptureValidateFieldName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"contentId":  true,
+		"createdAt":  false,
+		"updatedAt":  false,
+		"capturedBy": false,
+		"_id":        false,
+		"$where":     false,
+		"reply.id":   false,
+	} {
+		o := NewCaptureOptions()
+		o.Rules = []CaptureRule{{
+			Name:        "comments",
+			ContentType: "json",
+			Fields:      []CaptureField{{Name: "id", JSONPath: "$.id"}, {Name: name, JSONPath: "$.value"}},
+			Collection:  "comments",
+			UpsertKeys:  []string{"id"},
+		}}
+		assert.Equal(t, valid, len(o.Validate()) == 0, name)
+	}
+}
@@ -0,0 +1,29 @@
+package options
+
+import (
+	"fmt"
+)
+
+// CertCacheOptions 包含 MITM 证书缓存的配置选项
+type CertCacheOptions struct {
+	Size int    `json:"size" mapstructure:"size"` // 内存中最多缓存的证书数
+	Dir  string `json:"dir"  mapstructure:"dir"`  // 持久化目录, 为空则只缓存在内存中
+}
+
+// NewCertCacheOptions 创建一个带有默认值的 CertCacheOptions
+func NewCertCacheOptions() *CertCacheOptions {
+	return &CertCacheOptions{
+		Size: 1024,
+	}
+}
+
+// Validate 验证证书缓存配置选项是否合法
+func (o *CertCacheOptions) Validate() []error {
+	var errs []error
+
+	if o.Size <= 0 {
+		errs = append(errs, fmt.Errorf("cert-cache size必须大于0"))
+	}
+
+	return errs
+}
@@ -0,0 +1,74 @@
+package options
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// HarOptions 包含 HAR 录制的配置选项
+type HarOptions struct {
+	Enabled bool   `json:"enabled" mapstructure:"enabled"`
+	Dir     string `json:"dir"     mapstructure:"dir"`
+	// 单个文件最大字节数(MB), 超过后轮转
+	MaxSize int `json:"max-size" mapstructure:"max-size"`
+	// 单个文件最长写入时间, 超过后轮转
+	MaxAge time.Duration `json:"max-age" mapstructure:"max-age"`
+	// 只录制命中规则的请求, 否则录制所有被拦截的请求
+	OnlyMatched bool `json:"only-matched" mapstructure:"only-matched"`
+	// 需要脱敏的查询参数, 同时会脱敏正文中 "参数=值" 形式的内容
+	RedactParams []string `json:"redact-params" mapstructure:"redact-params"`
+	// 需要脱敏的请求/响应头, Cookie 和 Set-Cookie 总是会被脱敏
+	RedactHeaders []string `json:"redact-headers" mapstructure:"redact-headers"`
+	// 正文脱敏正则, 第一个捕获组会被替换
+	RedactBody []string `json:"redact-body" mapstructure:"redact-body"`
+}
+
+// NewHarOptions 创建一个带有默认值的 HarOptions
+func NewHarOptions() *HarOptions {
+	return &HarOptions{
+		Dir:         "./har",
+		MaxSize:     100,
+		MaxAge:      time.Hour,
+		OnlyMatched: true,
+		RedactParams: []string{
+			"key", "pass_ticket", "uin", "appmsg_token", "wxtoken", "exportkey", "devicetype", "version",
+		},
+		RedactHeaders: []string{
+			"Authorization", "X-Wechat-Key", "X-Wechat-Uin",
+		},
+		RedactBody: []string{
+			`(?:pass_ticket|appmsg_token|uin|key)\s*[:=]\s*["']([^"']*)["']`,
+		},
+	}
+}
+
+// Validate 验证 HAR 录制配置选项是否合法
+func (o *HarOptions) Validate() []error {
+	var errs []error
+
+	if !o.Enabled {
+		return errs
+	}
+
+	if o.Dir == "" {
+		errs = append(errs, fmt.Errorf("har dir不能为空"))
+	}
+
+	if o.MaxSize < 0 {
+		errs = append(errs, fmt.Errorf("har max-size不能小于0"))
+	}
+
+	for _, p := range o.RedactBody {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("har redact-body格式错误: %s", p))
+			continue
+		}
+		if re.NumSubexp() < 1 {
+			errs = append(errs, fmt.Errorf("har redact-body缺少捕获组: %s", p))
+		}
+	}
+
+	return errs
+}
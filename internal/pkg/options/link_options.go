@@ -0,0 +1,68 @@
+package options
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"wechat-backup/internal/pkg/wxlink"
+)
+
+// LinkRawKeyEnv 保存原始链接加密密钥的环境变量
+const LinkRawKeyEnv = "WX_BACKUP_LINK_RAW_KEY"
+
+// LinkOptions 包含文章链接的配置选项.
+// 文章只保存规范链接, 配置了密钥时才加密保存带会话参数的原始链接
+type LinkOptions struct {
+	// base64 编码的 32 字节密钥, 按 raw-key-file、环境变量 WX_BACKUP_LINK_RAW_KEY、raw-key 的顺序取第一个非空值
+	RawKey     string `json:"-"            mapstructure:"raw-key"`
+	RawKeyFile string `json:"raw-key-file" mapstructure:"raw-key-file"`
+}
+
+// NewLinkOptions 创建一个带有默认值的 LinkOptions
+func NewLinkOptions() *LinkOptions {
+	return &LinkOptions{}
+}
+
+// Validate 验证文章链接配置选项是否合法
+func (o *LinkOptions) Validate() []error {
+	var errs []error
+
+	if _, err := o.Key(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Key 返回原始链接的加密密钥, 未配置时返回 nil
+func (o *LinkOptions) Key() ([]byte, error) {
+	var fromFile string
+	if o.RawKeyFile != "" {
+		data, err := os.ReadFile(o.RawKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取link raw-key-file失败: %v", err)
+		}
+		fromFile = string(data)
+	}
+
+	var encoded string
+	for _, v := range []string{fromFile, os.Getenv(LinkRawKeyEnv), o.RawKey} {
+		if encoded = strings.TrimSpace(v); encoded != "" {
+			break
+		}
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		// 错误信息中不输出密钥
+		return nil, fmt.Errorf("link raw-key必须是base64编码")
+	}
+	if len(key) != wxlink.KeySize {
+		return nil, fmt.Errorf("link raw-key必须是%d字节, 实际为%d字节", wxlink.KeySize, len(key))
+	}
+	return key, nil
+}
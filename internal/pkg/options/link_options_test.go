@@ -0,0 +1,53 @@
+package options
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wechat-backup/internal/pkg/wxlink"
+)
+
+func TestLinkKey(t *testing.T) {
+	encode := func(b byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, wxlink.KeySize))
+	}
+
+	o := NewLinkOptions()
+	key, err := o.Key()
+	require.NoError(t, err)
+	assert.Nil(t, key)
+
+	o.RawKey = encode(1)
+	key, err = o.Key()
+	require.NoError(t, err)
+	assert.Equal(t, byte(1), key[0])
+
+	t.Setenv(LinkRawKeyEnv, encode(2))
+	key, err = o.Key()
+	require.NoError(t, err)
+	assert.Equal(t, byte(2), key[0])
+
+	// 文件内容为空时使用下一个来源
+	file := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(file, []byte("\n"), 0o600))
+	o.RawKeyFile = file
+	key, err = o.Key()
+	require.NoError(t, err)
+	assert.Equal(t, byte(2), key[0])
+
+	require.NoError(t, os.WriteFile(file, []byte(encode(3)+"\n"), 0o600))
+	key, err = o.Key()
+	require.NoError(t, err)
+	assert.Equal(t, byte(3), key[0])
+
+	o.RawKeyFile = ""
+	o.RawKey = base64.StdEncoding.EncodeToString([]byte("short"))
+	t.Setenv(LinkRawKeyEnv, "")
+	assert.NotEmpty(t, o.Validate())
+}
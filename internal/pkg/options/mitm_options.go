@@ -0,0 +1,66 @@
+package options
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// MitmOptions 包含 MITM 拦截范围的配置选项
+type MitmOptions struct {
+	// 需要解密并交给规则处理的主机, 支持 glob 通配符和可选端口, 如 "*.weixin.qq.com:443"
+	Hosts []string `json:"hosts" mapstructure:"hosts"`
+	// 是否同时拦截图片主机
+	InterceptImages bool `json:"intercept-images" mapstructure:"intercept-images"`
+	// 图片主机列表, 仅在 InterceptImages 为 true 时生效
+	ImageHosts []string `json:"image-hosts" mapstructure:"image-hosts"`
+	// 命中规则时最多缓冲的消息体大小(KB), 压缩的消息体解压后也不能超过, 超过后不再交给规则处理, 直接透传
+	MaxBodySize int `json:"max-body-size" mapstructure:"max-body-size"`
+}
+
+// NewMitmOptions 创建一个带有默认值的 MitmOptions
+func NewMitmOptions() *MitmOptions {
+	return &MitmOptions{
+		Hosts:       []string{"mp.weixin.qq.com"},
+		ImageHosts:  []string{"mmbiz.qpic.cn"},
+		MaxBodySize: 10 << 10,
+	}
+}
+
+// InterceptHosts 返回实际需要拦截的主机模式
+func (o *MitmOptions) InterceptHosts() []string {
+	hosts := append([]string{}, o.Hosts...)
+	if o.InterceptImages {
+		hosts = append(hosts, o.ImageHosts...)
+	}
+	return hosts
+}
+
+// Validate 验证 MITM 配置选项是否合法
+func (o *MitmOptions) Validate() []error {
+	var errs []error
+
+	if len(o.Hosts) == 0 {
+		errs = append(errs, fmt.Errorf("mitm hosts不能为空"))
+	}
+	if o.MaxBodySize <= 0 {
+		errs = append(errs, fmt.Errorf("mitm max-body-size必须大于0"))
+	}
+
+	for _, h := range o.InterceptHosts() {
+		host := h
+		if hh, _, err := net.SplitHostPort(h); err == nil {
+			host = hh
+		}
+		if strings.TrimSpace(host) == "" {
+			errs = append(errs, fmt.Errorf("mitm host不能为空: %q", h))
+			continue
+		}
+		if _, err := path.Match(host, ""); err != nil {
+			errs = append(errs, fmt.Errorf("mitm host格式错误: %q", h))
+		}
+	}
+
+	return errs
+}
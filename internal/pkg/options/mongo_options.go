@@ -2,15 +2,49 @@ package options
 
 import (
 	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// MongoPasswordEnv 保存 MongoDB 密码的环境变量
+const MongoPasswordEnv = "WX_BACKUP_MONGO_PASSWORD"
+
 // MongoOptions 包含 MongoDB 的配置选项
 type MongoOptions struct {
-	Host     string `json:"host"     mapstructure:"host"`
-	Port     int    `json:"port"     mapstructure:"port"`
-	Username string `json:"username" mapstructure:"username"`
-	Password string `json:"password" mapstructure:"password"`
-	Database string `json:"database" mapstructure:"database"`
+	// 完整的连接串, 如 mongodb://host1,host2/?replicaSet=rs0 或 mongodb+srv://cluster.example.com.
+	// 设置后忽略 host、port 和 srv; 其余选项仍然生效, 但连接串中已有的参数优先
+	URI string `json:"-" mapstructure:"uri"`
+
+	Host string `json:"host" mapstructure:"host"`
+	Port int    `json:"port" mapstructure:"port"`
+	// 通过 DNS SRV 记录发现节点(mongodb+srv), 此时忽略 port
+	SRV bool `json:"srv" mapstructure:"srv"`
+
+	// 密码按 password-file、环境变量 WX_BACKUP_MONGO_PASSWORD、password 的顺序取第一个非空值
+	Username     string `json:"username"      mapstructure:"username"`
+	Password     string `json:"-"             mapstructure:"password"`
+	PasswordFile string `json:"password-file" mapstructure:"password-file"`
+	// 验证用户的数据库, 为空时使用驱动的默认值(admin)
+	AuthSource string `json:"auth-source" mapstructure:"auth-source"`
+
+	Database   string `json:"database"    mapstructure:"database"`
+	ReplicaSet string `json:"replica-set" mapstructure:"replica-set"`
+
+	// 使用 TLS 连接, tls-ca-file 为空时使用系统根证书
+	TLS       bool   `json:"tls"         mapstructure:"tls"`
+	TLSCAFile string `json:"tls-ca-file" mapstructure:"tls-ca-file"`
+
+	// 连接和首次 Ping 的超时
+	ConnectTimeout time.Duration `json:"connect-timeout" mapstructure:"connect-timeout"`
+	// 连接池大小, max-pool-size 为 0 表示不限制
+	MaxPoolSize     uint64        `json:"max-pool-size"      mapstructure:"max-pool-size"`
+	MinPoolSize     uint64        `json:"min-pool-size"      mapstructure:"min-pool-size"`
+	MaxConnIdleTime time.Duration `json:"max-conn-idle-time" mapstructure:"max-conn-idle-time"`
+	RetryWrites     bool          `json:"retry-writes"       mapstructure:"retry-writes"`
+	RetryReads      bool          `json:"retry-reads"        mapstructure:"retry-reads"`
 }
 
 // NewMongoOptions 创建一个带有默认值的 MongoOptions
@@ -19,6 +53,13 @@ func NewMongoOptions() *MongoOptions {
 		Host:     "localhost",
 		Port:     27017,
 		Database: "wechat_backup",
+
+		ConnectTimeout:  10 * time.Second,
+		MaxPoolSize:     100,
+		MinPoolSize:     10,
+		MaxConnIdleTime: 30 * time.Second,
+		RetryWrites:     true,
+		RetryReads:      true,
 	}
 }
 
@@ -26,21 +67,125 @@ func NewMongoOptions() *MongoOptions {
 func (o *MongoOptions) Validate() []error {
 	var errs []error
 
-	if o.Host == "" {
-		errs = append(errs, fmt.Errorf("mongo host不能为空"))
-	}
-
-	if o.Port <= 0 || o.Port > 65535 {
-		errs = append(errs, fmt.Errorf("mongo port必须在1-65535之间"))
+	if o.URI != "" {
+		if _, err := parseMongoURI(o.URI); err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		if o.Host == "" {
+			errs = append(errs, fmt.Errorf("mongo host不能为空"))
+		}
+		if !o.SRV && (o.Port <= 0 || o.Port > 65535) {
+			errs = append(errs, fmt.Errorf("mongo port必须在1-65535之间"))
+		}
 	}
 
 	if o.Database == "" {
 		errs = append(errs, fmt.Errorf("mongo database不能为空"))
 	}
 
-	if o.Username != "" && o.Password == "" {
-		errs = append(errs, fmt.Errorf("设置了用户名时密码不能为空"))
+	password, err := o.password()
+	if err != nil {
+		errs = append(errs, err)
+	} else if o.Username != "" && password == "" {
+		errs = append(errs, fmt.Errorf("设置了mongo username时需要通过password、password-file或环境变量%s设置密码", MongoPasswordEnv))
+	}
+
+	if o.TLSCAFile != "" {
+		if !o.TLS {
+			errs = append(errs, fmt.Errorf("设置mongo tls-ca-file时需要开启tls"))
+		}
+		if _, err := os.Stat(o.TLSCAFile); err != nil {
+			errs = append(errs, fmt.Errorf("mongo tls-ca-file无法读取: %v", err))
+		}
+	}
+
+	if o.ConnectTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("mongo connect-timeout必须大于0"))
+	}
+	if o.MaxPoolSize > 0 && o.MinPoolSize > o.MaxPoolSize {
+		errs = append(errs, fmt.Errorf("mongo min-pool-size不能大于max-pool-size"))
+	}
+	if o.MaxConnIdleTime < 0 {
+		errs = append(errs, fmt.Errorf("mongo max-conn-idle-time不能为负数"))
 	}
 
 	return errs
 }
+
+// ConnectionURI 返回连接串: 用户名和密码经过转义, replica-set、auth-source 和 TLS 选项作为参数加入
+func (o *MongoOptions) ConnectionURI() (string, error) {
+	var u *url.URL
+	if o.URI != "" {
+		parsed, err := parseMongoURI(o.URI)
+		if err != nil {
+			return "", err
+		}
+		u = parsed
+	} else {
+		u = &url.URL{Scheme: "mongodb", Host: o.Host, Path: "/"}
+		if o.SRV {
+			u.Scheme = "mongodb+srv"
+		} else {
+			u.Host = o.Host + ":" + strconv.Itoa(o.Port)
+		}
+	}
+
+	if o.Username != "" {
+		password, err := o.password()
+		if err != nil {
+			return "", err
+		}
+		u.User = url.UserPassword(o.Username, password)
+	}
+
+	query := u.Query()
+	setDefault := func(key, value string) {
+		if value != "" && query.Get(key) == "" {
+			query.Set(key, value)
+		}
+	}
+	setDefault("replicaSet", o.ReplicaSet)
+	setDefault("authSource", o.AuthSource)
+	if o.TLS {
+		setDefault("tls", "true")
+		setDefault("tlsCAFile", o.TLSCAFile)
+	}
+	u.RawQuery = query.Encode()
+	// 驱动要求参数前有 /
+	if u.Path == "" && u.RawQuery != "" {
+		u.Path = "/"
+	}
+
+	return u.String(), nil
+}
+
+// password 读取密码, 见 MongoOptions 的说明
+func (o *MongoOptions) password() (string, error) {
+	if o.PasswordFile != "" {
+		data, err := os.ReadFile(o.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("读取mongo password-file失败: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if password := os.Getenv(MongoPasswordEnv); password != "" {
+		return password, nil
+	}
+	return o.Password, nil
+}
+
+func parseMongoURI(uri string) (*url.URL, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		// 错误信息中包含连接串, 不输出以免泄露密码
+		return nil, fmt.Errorf("mongo uri格式错误")
+	}
+	if u.Scheme != "mongodb" && u.Scheme != "mongodb+srv" {
+		return nil, fmt.Errorf("mongo uri必须以mongodb://或mongodb+srv://开头")
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("mongo uri缺少主机地址")
+	}
+	return u, nil
+}
@@ -0,0 +1,66 @@
+package options
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ProxyUser 代理认证用户
+type ProxyUser struct {
+	Username string `json:"username" mapstructure:"username"`
+	Password string `json:"-"        mapstructure:"password"`
+}
+
+// ProxyAuthOptions 包含代理客户端访问控制的配置选项
+type ProxyAuthOptions struct {
+	// 允许访问代理的用户, 为空则不要求认证
+	Users []ProxyUser `json:"users" mapstructure:"users"`
+	// 允许访问代理的来源网段, 为空则不限制
+	AllowedCIDRs []string `json:"allowed-cidrs" mapstructure:"allowed-cidrs"`
+}
+
+// NewProxyAuthOptions 创建一个带有默认值的 ProxyAuthOptions
+func NewProxyAuthOptions() *ProxyAuthOptions {
+	return &ProxyAuthOptions{}
+}
+
+// UserMap 返回用户名到密码的映射
+func (o *ProxyAuthOptions) UserMap() map[string]string {
+	users := make(map[string]string, len(o.Users))
+	for _, u := range o.Users {
+		users[u.Username] = u.Password
+	}
+	return users
+}
+
+// Validate 验证代理访问控制配置选项是否合法
+func (o *ProxyAuthOptions) Validate() []error {
+	var errs []error
+
+	seen := make(map[string]bool)
+	for _, u := range o.Users {
+		if u.Username == "" || u.Password == "" {
+			errs = append(errs, fmt.Errorf("auth users的用户名和密码不能为空"))
+			continue
+		}
+		if strings.Contains(u.Username, ":") {
+			errs = append(errs, fmt.Errorf("auth用户名不能包含冒号: %s", u.Username))
+		}
+		if seen[u.Username] {
+			errs = append(errs, fmt.Errorf("auth用户名重复: %s", u.Username))
+		}
+		seen[u.Username] = true
+	}
+
+	for _, cidr := range o.AllowedCIDRs {
+		if net.ParseIP(cidr) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("auth allowed-cidrs格式错误: %s", cidr))
+		}
+	}
+
+	return errs
+}
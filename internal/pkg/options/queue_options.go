@@ -0,0 +1,109 @@
+package options
+
+import (
+	"fmt"
+	"time"
+)
+
+// QueueOptions 包含文章处理队列的配置选项
+type QueueOptions struct {
+	// 队列后端: memory(默认)只保存在内存中, 退出时未处理的任务会丢失;
+	// redis 使用 Redis Stream 持久化, 重启后继续处理未确认的任务, 需要可用的 Redis
+	Backend string `json:"backend" mapstructure:"backend"`
+	// 队列长度: 内存队列的容量; Redis Stream 中未处理完的文章数上限, 0 表示不限制
+	Size int `json:"size" mapstructure:"size"`
+	// Redis Stream 名称和消费组
+	Stream string `json:"stream" mapstructure:"stream"`
+	Group  string `json:"group"  mapstructure:"group"`
+	// 消费者名称, 为空时使用主机名. 多个实例共用一个 Stream 时需要各不相同
+	Consumer string `json:"consumer" mapstructure:"consumer"`
+	// 其它消费者超过该时间仍未确认的任务, 会在启动时被接管, 0 表示不接管
+	ClaimIdle time.Duration `json:"claim-idle" mapstructure:"claim-idle"`
+
+	// 处理文章的工作协程数
+	Workers int `json:"workers" mapstructure:"workers"`
+	// 队列已满时的策略: block 等待 push-timeout 后由代理直接保存; drop 丢弃文章;
+	// spill 写入 spill-dir 目录, 队列腾出位置后重新入队
+	Backpressure string        `json:"backpressure" mapstructure:"backpressure"`
+	PushTimeout  time.Duration `json:"push-timeout" mapstructure:"push-timeout"`
+	SpillDir     string        `json:"spill-dir"    mapstructure:"spill-dir"`
+
+	// 保存文章遇到临时错误(网络、超时等)时的最多重试次数, 重试后仍失败的文章转入死信
+	MaxRetries int `json:"max-retries" mapstructure:"max-retries"`
+	// 第一次重试前的等待时间, 之后每次翻倍, 不超过 retry-max-backoff
+	RetryBackoff    time.Duration `json:"retry-backoff"     mapstructure:"retry-backoff"`
+	RetryMaxBackoff time.Duration `json:"retry-max-backoff" mapstructure:"retry-max-backoff"`
+}
+
+// NewQueueOptions 创建一个带有默认值的 QueueOptions
+func NewQueueOptions() *QueueOptions {
+	return &QueueOptions{
+		Backend:   "memory",
+		Size:      100,
+		Stream:    "wx-backup:articles",
+		Group:     "article-workers",
+		ClaimIdle: 10 * time.Minute,
+
+		Workers:      10,
+		Backpressure: "block",
+		PushTimeout:  5 * time.Second,
+		SpillDir:     "./spill",
+
+		MaxRetries:      5,
+		RetryBackoff:    500 * time.Millisecond,
+		RetryMaxBackoff: 30 * time.Second,
+	}
+}
+
+// Validate 验证队列配置选项是否合法
+func (o *QueueOptions) Validate() []error {
+	var errs []error
+
+	switch o.Backend {
+	case "redis":
+		if o.Stream == "" {
+			errs = append(errs, fmt.Errorf("queue stream不能为空"))
+		}
+		if o.Group == "" {
+			errs = append(errs, fmt.Errorf("queue group不能为空"))
+		}
+		if o.ClaimIdle < 0 {
+			errs = append(errs, fmt.Errorf("queue claim-idle不能为负数"))
+		}
+		if o.Size < 0 {
+			errs = append(errs, fmt.Errorf("queue size不能为负数"))
+		}
+	case "memory":
+		if o.Size <= 0 {
+			errs = append(errs, fmt.Errorf("queue size必须大于0"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("queue backend只支持redis或memory: %q", o.Backend))
+	}
+
+	if o.Workers <= 0 {
+		errs = append(errs, fmt.Errorf("queue workers必须大于0"))
+	}
+	switch o.Backpressure {
+	case "block":
+		if o.PushTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("queue push-timeout必须大于0"))
+		}
+	case "drop":
+	case "spill":
+		if o.SpillDir == "" {
+			errs = append(errs, fmt.Errorf("queue spill-dir不能为空"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("queue backpressure只支持block、drop或spill: %q", o.Backpressure))
+	}
+
+	if o.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("queue max-retries不能为负数"))
+	}
+	if o.RetryBackoff <= 0 || o.RetryMaxBackoff < o.RetryBackoff {
+		errs = append(errs, fmt.Errorf("queue retry-backoff必须大于0且不大于retry-max-backoff"))
+	}
+
+	return errs
+}
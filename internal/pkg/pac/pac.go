@@ -0,0 +1,27 @@
+package pac
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Path PAC 文件的固定访问路径
+const Path = "/proxy.pac"
+
+// ContentType PAC 文件的 MIME 类型
+const ContentType = "application/x-ns-proxy-autoconfig"
+
+// Generate 生成 PAC 脚本: hosts 中的主机(支持 glob 通配符)走 proxyAddr, 其余直连
+func Generate(proxyAddr string, hosts []string) string {
+	var b strings.Builder
+
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("  host = host.toLowerCase();\n")
+	for _, h := range hosts {
+		fmt.Fprintf(&b, "  if (shExpMatch(host, %q)) return %q;\n", strings.ToLower(h), "PROXY "+proxyAddr)
+	}
+	b.WriteString("  return \"DIRECT\";\n")
+	b.WriteString("}\n")
+
+	return b.String()
+}
@@ -0,0 +1,19 @@
+package pac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	script := Generate("192.168.1.10:8101", []string{"mp.weixin.qq.com", "*.qpic.cn"})
+
+	assert.Equal(t, `function FindProxyForURL(url, host) {
+  host = host.toLowerCase();
+  if (shExpMatch(host, "mp.weixin.qq.com")) return "PROXY 192.168.1.10:8101";
+  if (shExpMatch(host, "*.qpic.cn")) return "PROXY 192.168.1.10:8101";
+  return "DIRECT";
+}
+`, script)
+}
@@ -0,0 +1,155 @@
+package proxyauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+)
+
+const realm = "wx-backup"
+
+type clientKey struct{}
+
+// Guard 代理客户端访问控制: 按 CIDR 白名单过滤来源 IP, 并可要求 Proxy-Authorization Basic 认证.
+// 通过校验的请求会在 context 中记录客户端身份(用户名, 未启用认证时为来源 IP).
+type Guard struct {
+	users  map[string]string
+	nets   []*net.IPNet
+	public map[string]bool
+}
+
+// New 创建访问控制, users 为用户名到密码的映射, cidrs 为允许的来源网段, 两者为空时不做限制
+func New(users map[string]string, cidrs []string) (*Guard, error) {
+	g := &Guard{users: users, public: make(map[string]bool)}
+
+	for _, cidr := range cidrs {
+		// 兼容直接写单个 IP
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "解析CIDR失败: %s", cidr)
+		}
+		g.nets = append(g.nets, ipNet)
+	}
+
+	return g, nil
+}
+
+// Public 设置无需认证的路径, 只对直接访问代理本身(非代理)的请求生效, 仍然校验来源 IP.
+// 用于 PAC 等设备在配置代理前就需要获取的资源.
+func (g *Guard) Public(paths ...string) *Guard {
+	for _, p := range paths {
+		g.public[p] = true
+	}
+	return g
+}
+
+// Wrap 包装代理处理器, 未通过校验的请求直接拒绝
+func (g *Guard) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := g.Check(w, r)
+		if !ok {
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, client)))
+	})
+}
+
+// Check 校验请求, 失败时写入错误响应并返回 false
+func (g *Guard) Check(w http.ResponseWriter, r *http.Request) (string, bool) {
+	ip := remoteIP(r)
+
+	if !g.allowIP(ip) {
+		log.Warnf("拒绝来自 %s 的代理请求: 不在允许的网段内", ip)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return "", false
+	}
+
+	if len(g.users) == 0 || g.isPublic(r) {
+		return ip, true
+	}
+
+	username, ok := g.authenticate(r.Header.Get("Proxy-Authorization"))
+	if !ok {
+		log.Warnf("拒绝来自 %s 的代理请求: 认证失败", ip)
+		w.Header().Set("Proxy-Authenticate", `Basic realm="`+realm+`"`)
+		http.Error(w, "Proxy Authentication Required", http.StatusProxyAuthRequired)
+		return "", false
+	}
+
+	return username, true
+}
+
+// ClientFromContext 返回 Wrap 记录的客户端身份
+func ClientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+func (g *Guard) isPublic(r *http.Request) bool {
+	return r.Method != http.MethodConnect && !r.URL.IsAbs() && g.public[r.URL.Path]
+}
+
+func (g *Guard) allowIP(ip string) bool {
+	if len(g.nets) == 0 {
+		return true
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, ipNet := range g.nets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Guard) authenticate(header string) (string, bool) {
+	const prefix = "Basic "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[len(prefix):]))
+	if err != nil {
+		return "", false
+	}
+
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", false
+	}
+
+	expected, exists := g.users[username]
+	if !exists || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+		return "", false
+	}
+
+	return username, true
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,94 @@
+package proxyauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(g *Guard, remoteAddr, auth string) (*httptest.ResponseRecorder, string) {
+	var client string
+	h := g.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client = ClientFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodConnect, "http://mp.weixin.qq.com:443", nil)
+	req.RemoteAddr = remoteAddr
+	if auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec, client
+}
+
+func TestGuard(t *testing.T) {
+	g, err := New(map[string]string{"phone1": "secret"}, []string{"192.168.1.0/24", "10.0.0.5"})
+	require.NoError(t, err)
+
+	// user:phone1 password:secret
+	const ok = "Basic cGhvbmUxOnNlY3JldA=="
+
+	rec, client := serve(g, "192.168.1.23:5000", ok)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "phone1", client)
+
+	rec, _ = serve(g, "10.0.0.5:5000", ok)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec, _ = serve(g, "172.16.0.1:5000", ok)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec, _ = serve(g, "192.168.1.23:5000", "")
+	assert.Equal(t, http.StatusProxyAuthRequired, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Proxy-Authenticate"))
+
+	// user:phone1 password:wrong
+	rec, _ = serve(g, "192.168.1.23:5000", "Basic cGhvbmUxOndyb25n")
+	assert.Equal(t, http.StatusProxyAuthRequired, rec.Code)
+}
+
+func TestGuardPublic(t *testing.T) {
+	g, err := New(map[string]string{"phone1": "secret"}, []string{"192.168.1.0/24"})
+	require.NoError(t, err)
+	g.Public("/proxy.pac")
+
+	h := g.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// 直接访问公开路径无需认证
+	req := httptest.NewRequest(http.MethodGet, "/proxy.pac", nil)
+	req.RemoteAddr = "192.168.1.23:5000"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// 通过代理访问同名路径仍需认证
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/proxy.pac", nil)
+	req.RemoteAddr = "192.168.1.23:5000"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusProxyAuthRequired, rec.Code)
+
+	// 来源IP仍然受限
+	req = httptest.NewRequest(http.MethodGet, "/proxy.pac", nil)
+	req.RemoteAddr = "172.16.0.1:5000"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestGuardOpen(t *testing.T) {
+	g, err := New(nil, nil)
+	require.NoError(t, err)
+
+	rec, client := serve(g, "172.16.0.1:5000", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "172.16.0.1", client)
+
+	_, err = New(nil, []string{"not-a-cidr"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// MemoryQueue 内存队列, 不持久化, 用于没有 Redis 的环境和测试.
+// 关闭后 Pop 仍会返回已写入的任务, 取完后才返回 ErrClosed
+type MemoryQueue struct {
+	ch  chan *Message
+	seq atomic.Uint64
+
+	mtx    sync.RWMutex
+	closed bool
+}
+
+// NewMemory 创建容量为 size 的内存队列
+func NewMemory(size int) *MemoryQueue {
+	return &MemoryQueue{ch: make(chan *Message, size)}
+}
+
+// Push 写入任务, 队列已满时返回 ErrFull
+func (q *MemoryQueue) Push(_ context.Context, payload []byte) error {
+	q.mtx.RLock()
+	defer q.mtx.RUnlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	msg := &Message{ID: strconv.FormatUint(q.seq.Add(1), 10), Payload: payload}
+	select {
+	case q.ch <- msg:
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+func (q *MemoryQueue) Pop(ctx context.Context) (*Message, error) {
+	select {
+	case msg, ok := <-q.ch:
+		if !ok {
+			return nil, ErrClosed
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Ack 内存队列不需要确认
+func (q *MemoryQueue) Ack(context.Context, *Message) error {
+	return nil
+}
+
+func (q *MemoryQueue) Close() error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.ch)
+	}
+	return nil
+}
+
+// Drain 取出队列中剩余的任务, 队列关闭后调用
+func (q *MemoryQueue) Drain() []*Message {
+	var msgs []*Message
+	for {
+		select {
+		case msg, ok := <-q.ch:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
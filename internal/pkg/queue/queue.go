@@ -0,0 +1,38 @@
+// Package queue 提供至少一次投递的任务队列: 任务在确认之前进程退出或崩溃, 重启后会再次投递.
+package queue
+
+import (
+	"context"
+
+	"github.com/marmotedu/errors"
+)
+
+var (
+	// ErrClosed 队列已关闭
+	ErrClosed = errors.New("队列已关闭")
+	// ErrFull 队列已满
+	ErrFull = errors.New("队列已满")
+)
+
+// Message 队列中的任务
+type Message struct {
+	ID      string
+	Payload []byte
+}
+
+// Queue 任务队列. 消费者处理完任务后调用 Ack, 未确认的任务会在重启后重新投递
+type Queue interface {
+	// Push 写入任务
+	Push(ctx context.Context, payload []byte) error
+	// Pop 阻塞读取一个任务, 队列关闭后返回 ErrClosed
+	Pop(ctx context.Context) (*Message, error)
+	// Ack 确认任务已处理完成
+	Ack(ctx context.Context, msg *Message) error
+	// Close 停止投递任务, 阻塞中的 Pop 返回 ErrClosed. 已取出的任务仍可以确认
+	Close() error
+}
+
+// Drainer 不持久化的队列, 关闭后可以取出剩余的任务, 这些任务在进程退出后丢失
+type Drainer interface {
+	Drain() []*Message
+}
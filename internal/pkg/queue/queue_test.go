@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory(2)
+
+	require.NoError(t, q.Push(ctx, []byte("a")))
+	require.NoError(t, q.Push(ctx, []byte("b")))
+	assert.ErrorIs(t, q.Push(ctx, []byte("c")), ErrFull)
+
+	msg, err := q.Pop(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(msg.Payload))
+
+	// 关闭后不再接收任务, 已写入的任务仍会被取出
+	require.NoError(t, q.Close())
+	assert.ErrorIs(t, q.Push(ctx, []byte("d")), ErrClosed)
+
+	msg, err = q.Pop(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(msg.Payload))
+
+	_, err = q.Pop(ctx)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestMemoryQueueDrain(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory(3)
+
+	require.NoError(t, q.Push(ctx, []byte("a")))
+	require.NoError(t, q.Push(ctx, []byte("b")))
+	require.NoError(t, q.Close())
+
+	msgs := q.Drain()
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "a", string(msgs[0].Payload))
+	assert.Equal(t, "b", string(msgs[1].Payload))
+	assert.Empty(t, q.Drain())
+}
+
+func newTestRedis(t *testing.T) redis.UniversalClient {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestRedisQueue(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+
+	q, err := NewRedis(ctx, client, "articles", "workers", "c1", 0)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Push(ctx, []byte("a")))
+	msg, err := q.Pop(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(msg.Payload))
+
+	// 确认后从 Stream 中删除
+	require.NoError(t, q.Ack(ctx, msg))
+	assert.Zero(t, client.XLen(ctx, "articles").Val())
+}
+
+func TestRedisQueueReplay(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+
+	q, err := NewRedis(ctx, client, "articles", "workers", "c1", 0)
+	require.NoError(t, err)
+	require.NoError(t, q.Push(ctx, []byte("a")))
+	require.NoError(t, q.Push(ctx, []byte("b")))
+	require.NoError(t, q.Push(ctx, []byte("c")))
+
+	// 取出两个任务, 只确认第二个, 模拟处理中途退出
+	a, err := q.Pop(ctx)
+	require.NoError(t, err)
+	b, err := q.Pop(ctx)
+	require.NoError(t, err)
+	require.NoError(t, q.Ack(ctx, b))
+	require.NoError(t, q.Close())
+
+	_, err = q.Pop(ctx)
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, q.Push(ctx, []byte("d")), ErrClosed)
+
+	// 重启后先重新投递未确认的任务, 再投递新任务
+	q, err = NewRedis(ctx, client, "articles", "workers", "c1", 0)
+	require.NoError(t, err)
+	defer q.Close()
+
+	msg, err := q.Pop(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, a.ID, msg.ID)
+	assert.Equal(t, "a", string(msg.Payload))
+
+	msg, err = q.Pop(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "c", string(msg.Payload))
+}
+
+func TestRedisQueueClaim(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+
+	old, err := NewRedis(ctx, client, "articles", "workers", "old", 0)
+	require.NoError(t, err)
+	require.NoError(t, old.Push(ctx, []byte("a")))
+	_, err = old.Pop(ctx)
+	require.NoError(t, err)
+	require.NoError(t, old.Close())
+
+	// 其它消费者未超时的任务不会被接管
+	q, err := NewRedis(ctx, client, "articles", "workers", "new", time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, q.pending)
+	require.NoError(t, q.Close())
+
+	time.Sleep(10 * time.Millisecond)
+	q, err = NewRedis(ctx, client, "articles", "workers", "new", time.Millisecond)
+	require.NoError(t, err)
+	defer q.Close()
+
+	msg, err := q.Pop(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(msg.Payload))
+}
+
+func TestRedisQueueCloseUnblocksPop(t *testing.T) {
+	client := newTestRedis(t)
+
+	q, err := NewRedis(context.Background(), client, "articles", "workers", "c1", 0)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := q.Pop(context.Background())
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, q.Close())
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrClosed)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Close 没有唤醒阻塞中的 Pop")
+	}
+}
+
+func TestRedisQueueMaxLen(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+
+	q, err := NewRedis(ctx, client, "articles", "workers", "c1", 0)
+	require.NoError(t, err)
+	defer q.Close()
+	q.SetMaxLen(1)
+
+	require.NoError(t, q.Push(ctx, []byte("a")))
+	assert.ErrorIs(t, q.Push(ctx, []byte("b")), ErrFull)
+
+	// 确认后腾出位置
+	msg, err := q.Pop(ctx)
+	require.NoError(t, err)
+	require.NoError(t, q.Ack(ctx, msg))
+	assert.NoError(t, q.Push(ctx, []byte("b")))
+}
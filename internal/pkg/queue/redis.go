@@ -0,0 +1,217 @@
+package queue
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	payloadField = "payload"
+	// 单次阻塞读取的最长时间. go-redis 不会中断阻塞中的读取, 关闭队列最多等待这么久
+	readBlock = time.Second
+)
+
+// RedisQueue 基于 Redis Stream 消费组的持久化队列.
+// 任务确认后从 Stream 中删除; 未确认的任务留在消费组的待确认列表中, 启动时重新投递
+type RedisQueue struct {
+	client   redis.UniversalClient
+	stream   string
+	group    string
+	consumer string
+	maxLen   int64
+
+	// 关闭后停止读取
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mtx     sync.Mutex
+	pending []*Message // 启动时恢复的未确认任务
+}
+
+// NewRedis 创建 Redis 队列, 消费组不存在时自动创建.
+// 启动时恢复本消费者上次未确认的任务, 并接管其它消费者超过 claimIdle 仍未确认的任务
+func NewRedis(ctx context.Context, client redis.UniversalClient, stream, group, consumer string, claimIdle time.Duration) (*RedisQueue, error) {
+	// 从头消费, 消费组创建之前写入的任务也会被处理
+	if err := client.XGroupCreateMkStream(ctx, stream, group, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, errors.Wrapf(err, "创建消费组 %s 失败", group)
+	}
+
+	q := &RedisQueue{
+		client:   client,
+		stream:   stream,
+		group:    group,
+		consumer: consumer,
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+
+	if err := q.recover(ctx, claimIdle); err != nil {
+		return nil, err
+	}
+	if len(q.pending) > 0 {
+		log.Infof("队列 %s 恢复 %d 个未确认的任务", stream, len(q.pending))
+	}
+
+	return q, nil
+}
+
+// recover 读取需要重新投递的任务
+func (q *RedisQueue) recover(ctx context.Context, claimIdle time.Duration) error {
+	seen := make(map[string]bool)
+	add := func(msgs []redis.XMessage) {
+		for _, m := range msgs {
+			if seen[m.ID] {
+				continue
+			}
+			seen[m.ID] = true
+			q.pending = append(q.pending, toMessage(m))
+		}
+	}
+
+	// 指定 ID 读取时返回本消费者的待确认任务
+	start := "0"
+	for {
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    q.group,
+			Consumer: q.consumer,
+			Streams:  []string{q.stream, start},
+			Count:    100,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return errors.Wrap(err, "读取未确认的任务失败")
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			break
+		}
+		msgs := streams[0].Messages
+		add(msgs)
+		start = msgs[len(msgs)-1].ID
+	}
+
+	if claimIdle <= 0 {
+		return nil
+	}
+
+	// 接管已下线或改名的消费者留下的任务
+	start = "0-0"
+	for {
+		msgs, next, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   q.stream,
+			Group:    q.group,
+			Consumer: q.consumer,
+			MinIdle:  claimIdle,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			return errors.Wrap(err, "接管未确认的任务失败")
+		}
+		add(msgs)
+		if next == "0-0" || next == "" {
+			break
+		}
+		start = next
+	}
+
+	return nil
+}
+
+// SetMaxLen 设置队列长度上限, Stream 中未确认的任务达到上限时 Push 返回 ErrFull.
+// 检查和写入不是原子操作, 多个实例同时写入时可能略微超出. 0 表示不限制
+func (q *RedisQueue) SetMaxLen(n int64) {
+	q.maxLen = n
+}
+
+// Push 写入任务, 设置了长度上限且队列已满时返回 ErrFull
+func (q *RedisQueue) Push(ctx context.Context, payload []byte) error {
+	if q.ctx.Err() != nil {
+		return ErrClosed
+	}
+
+	// 确认后的任务会从 Stream 中删除, 长度即未处理完的任务数
+	if q.maxLen > 0 {
+		n, err := q.client.XLen(ctx, q.stream).Result()
+		if err != nil {
+			return errors.Wrap(err, "读取队列长度失败")
+		}
+		if n >= q.maxLen {
+			return ErrFull
+		}
+	}
+
+	err := q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.stream,
+		Values: map[string]interface{}{payloadField: payload},
+	}).Err()
+	return errors.Wrap(err, "写入任务失败")
+}
+
+// Pop 先返回启动时恢复的任务, 之后阻塞读取新任务
+func (q *RedisQueue) Pop(ctx context.Context) (*Message, error) {
+	q.mtx.Lock()
+	if len(q.pending) > 0 && q.ctx.Err() == nil {
+		msg := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mtx.Unlock()
+		return msg, nil
+	}
+	q.mtx.Unlock()
+
+	for {
+		if q.ctx.Err() != nil {
+			return nil, ErrClosed
+		}
+
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    q.group,
+			Consumer: q.consumer,
+			Streams:  []string{q.stream, ">"},
+			Count:    1,
+			Block:    readBlock,
+		}).Result()
+		switch {
+		case q.ctx.Err() != nil:
+			return nil, ErrClosed
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, redis.Nil):
+			continue
+		case err != nil:
+			return nil, errors.Wrap(err, "读取任务失败")
+		}
+
+		if len(streams) > 0 && len(streams[0].Messages) > 0 {
+			return toMessage(streams[0].Messages[0]), nil
+		}
+	}
+}
+
+// Ack 确认并删除任务
+func (q *RedisQueue) Ack(ctx context.Context, msg *Message) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, q.stream, q.group, msg.ID)
+		pipe.XDel(ctx, q.stream, msg.ID)
+		return nil
+	})
+	return errors.Wrapf(err, "确认任务 %s 失败", msg.ID)
+}
+
+// Close 停止读取任务, 不关闭 Redis 连接
+func (q *RedisQueue) Close() error {
+	q.cancel()
+	return nil
+}
+
+func toMessage(m redis.XMessage) *Message {
+	msg := &Message{ID: m.ID}
+	// 已删除的任务仍可能留在待确认列表中, 此时没有内容
+	if v, ok := m.Values[payloadField].(string); ok {
+		msg.Payload = []byte(v)
+	}
+	return msg
+}
@@ -0,0 +1,95 @@
+package hostmatch
+
+import (
+	"net"
+	"path"
+	"strings"
+)
+
+// Matcher 按 "host[:port]" 形式的模式匹配主机, host 部分支持 glob 通配符.
+// 模式不带端口时匹配任意端口.
+type Matcher struct {
+	patterns []pattern
+}
+
+type pattern struct {
+	host string
+	port string
+}
+
+// New 创建主机匹配器, 空模式会被忽略
+func New(patterns ...string) *Matcher {
+	m := &Matcher{}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+
+		host, port := SplitHostPort(p)
+		m.patterns = append(m.patterns, pattern{host: host, port: port})
+	}
+	return m
+}
+
+// Match 判断 addr 是否匹配任一模式, addr 形如 "host" 或 "host:port"
+func (m *Matcher) Match(addr string) bool {
+	if m == nil {
+		return false
+	}
+
+	host, port := SplitHostPort(strings.ToLower(addr))
+	for _, p := range m.patterns {
+		if p.port != "" && p.port != port {
+			continue
+		}
+		if ok, _ := path.Match(p.host, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Hosts 返回所有模式的 host 部分(去重), 供生成 PAC 等场景使用
+func (m *Matcher) Hosts() []string {
+	if m == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, p := range m.patterns {
+		if seen[p.host] {
+			continue
+		}
+		seen[p.host] = true
+		hosts = append(hosts, p.host)
+	}
+	return hosts
+}
+
+// Empty 判断是否没有任何模式
+func (m *Matcher) Empty() bool {
+	return m == nil || len(m.patterns) == 0
+}
+
+// SplitHostPort 拆分主机和端口, 没有端口时 port 为空
+func SplitHostPort(addr string) (host, port string) {
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		return h, p
+	}
+	return strings.Trim(addr, "[]"), ""
+}
+
+// WithDefaultPort 为没有端口的主机补上协议的默认端口(https 为 443, 其余为 80),
+// 让带端口的模式也能匹配 URL 中省略的端口
+func WithDefaultPort(host, scheme string) string {
+	h, port := SplitHostPort(host)
+	if port != "" {
+		return host
+	}
+	if strings.EqualFold(scheme, "https") {
+		return net.JoinHostPort(h, "443")
+	}
+	return net.JoinHostPort(h, "80")
+}
@@ -0,0 +1,44 @@
+package hostmatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	m := New("mp.weixin.qq.com", "*.qpic.cn:443", " ")
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"mp.weixin.qq.com:443", true},
+		{"mp.weixin.qq.com:80", true},
+		{"MP.WEIXIN.QQ.COM", true},
+		{"res.wx.qq.com:443", false},
+		{"mmbiz.qpic.cn:443", true},
+		{"mmbiz.qpic.cn:80", false},
+		{"mmbiz.qpic.cn", false},
+		{"qpic.cn:443", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, m.Match(tt.addr), tt.addr)
+	}
+
+	assert.Equal(t, []string{"mp.weixin.qq.com", "*.qpic.cn"}, m.Hosts())
+}
+
+func TestNilMatcher(t *testing.T) {
+	var m *Matcher
+	assert.False(t, m.Match("mp.weixin.qq.com:443"))
+	assert.True(t, m.Empty())
+}
+
+func TestWithDefaultPort(t *testing.T) {
+	assert.Equal(t, "mp.weixin.qq.com:443", WithDefaultPort("mp.weixin.qq.com", "https"))
+	assert.Equal(t, "mp.weixin.qq.com:80", WithDefaultPort("mp.weixin.qq.com", "http"))
+	assert.Equal(t, "mp.weixin.qq.com:8443", WithDefaultPort("mp.weixin.qq.com:8443", "https"))
+	assert.Equal(t, "[::1]:443", WithDefaultPort("[::1]", "https"))
+}
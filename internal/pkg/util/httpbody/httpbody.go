@@ -0,0 +1,119 @@
+// Package httpbody 处理 HTTP 消息体的压缩和字符集, 让规则总是看到 UTF-8 明文.
+package httpbody
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"github.com/marmotedu/errors"
+	"golang.org/x/net/html/charset"
+)
+
+// ErrTooLarge 解压后的内容超过上限
+var ErrTooLarge = errors.New("解压后的内容超过上限")
+
+// Decompress 按 Content-Encoding 解压, 多个编码按逆序依次解压. 不支持的编码返回错误,
+// 每一步解压的结果最多 limit 字节, 超过时返回 ErrTooLarge, 防止压缩炸弹耗尽内存
+func Decompress(body []byte, contentEncoding string, limit int64) ([]byte, error) {
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		enc := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if len(body) == 0 {
+			return body, nil
+		}
+
+		var (
+			r   io.Reader
+			err error
+		)
+		switch enc {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(body))
+		case "br":
+			r = brotli.NewReader(bytes.NewReader(body))
+		case "deflate":
+			// 标准要求 zlib 封装, 但也有服务端直接发送原始 deflate 数据
+			if r, err = zlib.NewReader(bytes.NewReader(body)); err != nil {
+				r, err = flate.NewReader(bytes.NewReader(body)), nil
+			}
+		default:
+			return nil, errors.Errorf("不支持的内容编码: %s", enc)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "解压 %s 失败", enc)
+		}
+
+		if body, err = io.ReadAll(io.LimitReader(r, limit+1)); err != nil {
+			return nil, errors.Wrapf(err, "解压 %s 失败", enc)
+		}
+		if int64(len(body)) > limit {
+			return nil, ErrTooLarge
+		}
+	}
+
+	return body, nil
+}
+
+// ToUTF8 将文本内容转换为 UTF-8, 返回是否进行了转换.
+// 字符集取自 Content-Type, HTML 没有声明时从 meta 标签中查找; 未声明字符集且本身是合法 UTF-8 时不转换
+func ToUTF8(body []byte, contentType string) ([]byte, bool, error) {
+	if !IsText(contentType) || len(body) == 0 {
+		return body, false, nil
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	label := params["charset"]
+	if label == "" {
+		if mediaType != "text/html" || utf8.Valid(body) {
+			return body, false, nil
+		}
+		_, label, _ = charset.DetermineEncoding(body, contentType)
+	}
+
+	enc, name := charset.Lookup(label)
+	if enc == nil {
+		return body, false, errors.Errorf("不支持的字符集: %s", label)
+	}
+	if name == "utf-8" {
+		return body, false, nil
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, false, errors.Wrapf(err, "转换字符集 %s 失败", name)
+	}
+	return decoded, true, nil
+}
+
+// IsText 判断内容类型是否为规则需要处理的文本
+func IsText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "javascript") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+// WithCharset 返回替换了 charset 参数的 Content-Type
+func WithCharset(contentType string, cs string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	params["charset"] = cs
+	return mime.FormatMediaType(mediaType, params)
+}
@@ -0,0 +1,118 @@
+package httpbody
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func encode(t *testing.T, data []byte, newWriter func(io.Writer) io.WriteCloser) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	return encode(t, data, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+}
+
+func TestDecompress(t *testing.T) {
+	plain := []byte("<html><body>公众号文章</body></html>")
+
+	tests := []struct {
+		name     string
+		body     []byte
+		encoding string
+	}{
+		{"identity", plain, ""},
+		{"explicit identity", plain, "identity"},
+		{"gzip", gzipped(t, plain), "gzip"},
+		{"x-gzip", gzipped(t, plain), "X-Gzip"},
+		{"br", encode(t, plain, func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }), "br"},
+		{"deflate zlib", encode(t, plain, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }), "deflate"},
+		{"deflate raw", encode(t, plain, func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		}), "deflate"},
+		// 先 gzip 再 br, 解压时逆序
+		{"chained", encode(t, gzipped(t, plain), func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }), "gzip, br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decompress(tt.body, tt.encoding, 1<<20)
+			require.NoError(t, err)
+			assert.Equal(t, string(plain), string(got))
+		})
+	}
+}
+
+func TestDecompressError(t *testing.T) {
+	_, err := Decompress([]byte("data"), "compress", 1<<20)
+	assert.Error(t, err)
+
+	_, err = Decompress([]byte("not gzip"), "gzip", 1<<20)
+	assert.Error(t, err)
+
+	// 空响应体不需要解压
+	got, err := Decompress(nil, "gzip", 1<<20)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	// 解压后超过上限
+	bomb := gzipped(t, bytes.Repeat([]byte{0}, 1<<20))
+	_, err = Decompress(bomb, "gzip", 1<<10)
+	assert.ErrorIs(t, err, ErrTooLarge)
+	got, err = Decompress(bomb, "gzip", 1<<20)
+	require.NoError(t, err)
+	assert.Len(t, got, 1<<20)
+}
+
+func TestToUTF8(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String("<html><body>公众号文章</body></html>")
+	require.NoError(t, err)
+	meta := `<html><head><meta charset="gbk"></head><body>` + gbk[len("<html><body>"):]
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        string
+		converted   bool
+	}{
+		{"utf-8", "公众号文章", "text/html; charset=utf-8", "公众号文章", false},
+		{"no charset", "公众号文章", "application/json", "公众号文章", false},
+		{"gbk header", gbk, "text/html; charset=GBK", "<html><body>公众号文章</body></html>", true},
+		{"gbk meta", meta, "text/html", `<html><head><meta charset="gbk"></head><body>公众号文章</body></html>`, true},
+		{"binary", gbk, "image/png", gbk, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, converted, err := ToUTF8([]byte(tt.body), tt.contentType)
+			require.NoError(t, err)
+			assert.Equal(t, tt.converted, converted)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	_, _, err = ToUTF8([]byte("x"), "text/plain; charset=unknown-charset")
+	assert.Error(t, err)
+}
+
+func TestWithCharset(t *testing.T) {
+	assert.Equal(t, "text/html; charset=utf-8", WithCharset("text/html; charset=GBK", "utf-8"))
+	assert.Equal(t, "application/json; charset=utf-8", WithCharset("application/json", "utf-8"))
+	assert.Equal(t, "", WithCharset("", "utf-8"))
+}
@@ -0,0 +1,30 @@
+package wxlink
+
+import "regexp"
+
+// Redacted 替换会话参数值的占位符
+const Redacted = "REDACTED"
+
+// sessionParams 与阅读者会话相关的参数, 日志和保存的页面中不能出现它们的值
+const sessionParams = `key|pass_ticket|uin|appmsg_token|wxtoken|exportkey`
+
+var (
+	// 链接中的参数: key=xxx、&amp;pass_ticket=xxx
+	sessionQuery = regexp.MustCompile(`\b(` + sessionParams + `)=([^&"'\s<>\\#]+)`)
+	// 页面中的全局变量: var pass_ticket = "xxx"、window.appmsg_token = 'xxx'
+	sessionGlobal = regexp.MustCompile(`((?:var\s+|window\.)(?:` + sessionParams + `)\s*=\s*)("[^"]*"|'[^']*')`)
+)
+
+// Redact 把链接或页面中的会话参数值替换为 REDACTED, 其余内容原样返回
+func Redact(text string) string {
+	text = sessionQuery.ReplaceAllString(text, "${1}="+Redacted)
+	return sessionGlobal.ReplaceAllStringFunc(text, func(m string) string {
+		sub := sessionGlobal.FindStringSubmatch(m)
+		quote := sub[2][:1]
+		if len(sub[2]) == 2 {
+			// 空值没有需要脱敏的内容
+			return m
+		}
+		return sub[1] + quote + Redacted + quote
+	})
+}
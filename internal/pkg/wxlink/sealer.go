@@ -0,0 +1,71 @@
+package wxlink
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	"github.com/marmotedu/errors"
+)
+
+// KeySize 加密密钥的字节数(AES-256)
+const KeySize = 32
+
+// Sealer 用 AES-256-GCM 加密原始链接, 密文为 base64(nonce + 密文)
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer 用 32 字节的密钥创建 Sealer
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("密钥长度必须为 %d 字节, 实际为 %d 字节", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "创建加密器失败")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "创建加密器失败")
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal 加密原始链接, 空链接返回空字符串
+func (s *Sealer) Seal(link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrap(err, "生成随机数失败")
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(link), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open 解密 Seal 的结果
+func (s *Sealer) Open(sealed string) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", errors.Wrap(err, "密文格式错误")
+	}
+	size := s.aead.NonceSize()
+	if len(data) < size {
+		return "", errors.New("密文长度错误")
+	}
+	link, err := s.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", errors.Wrap(err, "解密失败, 密钥可能不正确")
+	}
+	return string(link), nil
+}
@@ -0,0 +1,61 @@
+// Package wxlink 规范化公众号文章链接.
+// 抓取到的链接带有 key、pass_ticket、uin 等与阅读者会话相关的参数, 规范链接只保留文章标识,
+// 原始链接需要保留时用 Sealer 加密.
+package wxlink
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Host 公众号文章所在的域名
+const Host = "mp.weixin.qq.com"
+
+// 规范链接保留的参数, 按顺序输出
+var (
+	articleParams = []string{"__biz", "mid", "idx", "sn"}
+	// 旧版图文消息页面 /mp/appmsg/show
+	legacyParams = []string{"__biz", "appmsgid", "itemidx", "sign"}
+)
+
+// Canonical 返回文章的规范链接: https://mp.weixin.qq.com/s?__biz=..&mid=..&idx=..&sn=..
+// 旧版图文消息页面保留 __biz、appmsgid、itemidx 和 sign, 短链接 /s/<ID> 去掉参数.
+// 不是公众号文章的链接原样返回
+func Canonical(link string) string {
+	u, err := url.Parse(strings.ReplaceAll(link, "&amp;", "&"))
+	if err != nil || u.Hostname() != Host {
+		return link
+	}
+
+	var keep []string
+	switch {
+	case u.Path == "/s":
+		keep = articleParams
+	case u.Path == "/mp/appmsg/show":
+		keep = legacyParams
+	case strings.HasPrefix(u.Path, "/s/"):
+	default:
+		return link
+	}
+
+	query := u.Query()
+	params := make([]string, 0, len(keep))
+	for _, k := range keep {
+		if v := query.Get(k); v != "" {
+			params = append(params, k+"="+queryEscape(v))
+		}
+	}
+
+	canonical := url.URL{Scheme: "https", Host: Host, Path: u.Path, RawQuery: strings.Join(params, "&")}
+	return canonical.String()
+}
+
+// queryEscape 转义参数值, 与微信的链接一致, __biz 末尾的 = 不转义
+func queryEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "%3D", "=")
+}
+
+// IsCanonical 链接是否已经是规范链接
+func IsCanonical(link string) bool {
+	return Canonical(link) == link
+}
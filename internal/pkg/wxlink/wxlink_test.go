@@ -0,0 +1,126 @@
+package wxlink
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonical(t *testing.T) {
+	cases := []struct {
+		name string
+		link string
+		want string
+	}{
+		{
+			name: "会话参数",
+			link: "http://mp.weixin.qq.com:443/s?scene=27&idx=1&__biz=MzA5&mid=2650&sn=abc&chksm=xyz&key=k&pass_ticket=p&uin=u&devicetype=d&version=v#wechat_redirect",
+			want: "https://mp.weixin.qq.com/s?__biz=MzA5&mid=2650&idx=1&sn=abc",
+		},
+		{
+			name: "转义的参数",
+			link: "http://mp.weixin.qq.com/s?__biz=MzA5&amp;mid=2650&amp;idx=2&amp;sn=abc&amp;scene=27",
+			want: "https://mp.weixin.qq.com/s?__biz=MzA5&mid=2650&idx=2&sn=abc",
+		},
+		{
+			name: "biz中的等号",
+			link: "https://mp.weixin.qq.com/s?__biz=MzA5MDAwMDAwMQ%3D%3D&mid=1&idx=1&sn=a+b",
+			want: "https://mp.weixin.qq.com/s?__biz=MzA5MDAwMDAwMQ==&mid=1&idx=1&sn=a+b",
+		},
+		{
+			name: "旧版图文消息",
+			link: "https://mp.weixin.qq.com/mp/appmsg/show?__biz=MzA5&appmsgid=10000006&itemidx=1&sign=s&key=k&uin=u#wechat_redirect",
+			want: "https://mp.weixin.qq.com/mp/appmsg/show?__biz=MzA5&appmsgid=10000006&itemidx=1&sign=s",
+		},
+		{
+			name: "短链接",
+			link: "https://mp.weixin.qq.com/s/AbC-12_x?key=k&pass_ticket=p",
+			want: "https://mp.weixin.qq.com/s/AbC-12_x",
+		},
+		{
+			name: "其它页面",
+			link: "https://mp.weixin.qq.com/mp/profile_ext?action=home&__biz=MzA5&key=k",
+			want: "https://mp.weixin.qq.com/mp/profile_ext?action=home&__biz=MzA5&key=k",
+		},
+		{
+			name: "其它域名",
+			link: "https://example.com/s?__biz=MzA5&key=k",
+			want: "https://example.com/s?__biz=MzA5&key=k",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := Canonical(c.link)
+			assert.Equal(t, c.want, got)
+			// 重复规范化结果不变
+			assert.Equal(t, got, Canonical(got))
+			assert.True(t, IsCanonical(got))
+		})
+	}
+}
+
+func TestSealer(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	s, err := NewSealer(key)
+	require.NoError(t, err)
+
+	link := "https://mp.weixin.qq.com/s?__biz=MzA5&mid=1&idx=1&sn=abc&key=k&pass_ticket=p"
+	sealed, err := s.Seal(link)
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, "pass_ticket")
+
+	// 每次加密使用不同的随机数
+	again, err := s.Seal(link)
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	opened, err := s.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, link, opened)
+
+	other, err := NewSealer(bytes.Repeat([]byte{2}, KeySize))
+	require.NoError(t, err)
+	_, err = other.Open(sealed)
+	assert.ErrorContains(t, err, "解密失败")
+
+	_, err = NewSealer(key[:16])
+	assert.ErrorContains(t, err, "密钥长度")
+}
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "链接参数",
+			text: "https://mp.weixin.qq.com/mp/profile_ext?action=home&__biz=MzA5&key=k1&uin=u1&pass_ticket=p1#wechat_redirect",
+			want: "https://mp.weixin.qq.com/mp/profile_ext?action=home&__biz=MzA5&key=REDACTED&uin=REDACTED&pass_ticket=REDACTED#wechat_redirect",
+		},
+		{
+			name: "转义的链接参数",
+			text: `<a href="/s?__biz=MzA5&amp;appmsg_token=t1&amp;mid=1">`,
+			want: `<a href="/s?__biz=MzA5&amp;appmsg_token=REDACTED&amp;mid=1">`,
+		},
+		{
+			name: "页面全局变量",
+			text: `var pass_ticket = "p1"; window.appmsg_token = 't1'; var uin = ""; var wxtoken="w1";`,
+			want: `var pass_ticket = "REDACTED"; window.appmsg_token = 'REDACTED'; var uin = ""; var wxtoken="REDACTED";`,
+		},
+		{
+			name: "相似的名称",
+			text: `var monkey = "m"; data-key="d"; api_key=a; var msg_title = "t";`,
+			want: `var monkey = "m"; data-key="d"; api_key=a; var msg_title = "t";`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, Redact(c.text))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/mongo"
+)
+
+// DeadLetterRepository 重试后仍保存失败的文章
+type DeadLetterRepository struct {
+	db *mongo.DB
+}
+
+// Add 保存失败的文章和最后一次的错误
+func (r *DeadLetterRepository) Add(ctx context.Context, post *model.Post, cause error, attempts int) error {
+	now := time.Now()
+	dl := &model.DeadLetter{
+		BaseModel: model.BaseModel{ID: primitive.NewObjectID(), CreatedAt: now, UpdatedAt: now},
+		Post:      post,
+		Error:     cause.Error(),
+		Attempts:  attempts,
+	}
+	_, err := r.db.Collection(model.CollectionDeadLetters).InsertOne(ctx, dl)
+	return errors.Wrap(err, "保存死信失败")
+}
+
+// List 按保存时间返回死信, limit 为 0 时返回全部
+func (r *DeadLetterRepository) List(ctx context.Context, limit int64) ([]*model.DeadLetter, error) {
+	opts := options.Find().SetSort(bson.D{{Key: model.FieldCreatedAt, Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	var list []*model.DeadLetter
+	if err := findAll(ctx, r.db.Collection(model.CollectionDeadLetters), bson.M{}, &list, opts); err != nil {
+		return nil, errors.Wrap(err, "查询死信失败")
+	}
+	return list, nil
+}
+
+// Find 按 ID 返回死信, 按保存时间排序
+func (r *DeadLetterRepository) Find(ctx context.Context, ids []primitive.ObjectID) ([]*model.DeadLetter, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	opts := options.Find().SetSort(bson.D{{Key: model.FieldCreatedAt, Value: 1}})
+
+	var list []*model.DeadLetter
+	filter := bson.M{model.FieldID: bson.M{"$in": ids}}
+	if err := findAll(ctx, r.db.Collection(model.CollectionDeadLetters), filter, &list, opts); err != nil {
+		return nil, errors.Wrap(err, "查询死信失败")
+	}
+	return list, nil
+}
+
+// Delete 删除死信
+func (r *DeadLetterRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.db.Collection(model.CollectionDeadLetters).DeleteOne(ctx, bson.M{model.FieldID: id})
+	return errors.Wrap(err, "删除死信失败")
+}
+
+// Purge 删除全部死信, 返回删除的数量
+func (r *DeadLetterRepository) Purge(ctx context.Context) (int64, error) {
+	result, err := r.db.Collection(model.CollectionDeadLetters).DeleteMany(ctx, bson.M{})
+	if err != nil {
+		return 0, errors.Wrap(err, "清空死信失败")
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"wechat-backup/internal/model"
+)
+
+// UpsertDocument 按 keys 中的字段查找 collection 中的文档, 存在时更新其余字段, 不存在时插入.
+// 用于声明式规则保存的任意文档
+func (r *Repository) UpsertDocument(ctx context.Context, collection string, keys []string, doc map[string]interface{}) error {
+	filter := bson.M{}
+	set := bson.M{model.FieldUpdatedAt: time.Now()}
+	for k, v := range doc {
+		set[k] = v
+	}
+	for _, k := range keys {
+		filter[k] = doc[k]
+		delete(set, k)
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$setOnInsert": bson.M{
+			model.FieldCreatedAt: time.Now(),
+		},
+	}
+
+	return errors.Wrapf(upsertOne(ctx, r.db.Collection(collection), filter, update), "保存到集合 %s 失败", collection)
+}
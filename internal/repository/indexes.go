@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/marmotedu/errors"
+	"github.com/marmotedu/log"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"wechat-backup/internal/model"
+)
+
+// collectionIndexes 各集合需要的索引. 唯一索引保证并发保存同一篇文章、同一个公众号时不会产生重复文档
+var collectionIndexes = map[string][]driver.IndexModel{
+	model.CollectionPosts: {
+		{
+			Keys:    bson.D{{Key: model.FieldMsgBiz, Value: 1}, {Key: model.FieldMsgMid, Value: 1}, {Key: model.FieldMsgIdx, Value: 1}},
+			Options: options.Index().SetName("uniq_msgBiz_msgMid_msgIdx").SetUnique(true),
+		},
+		// 按公众号查询最早、最新的文章
+		{
+			Keys:    bson.D{{Key: model.FieldMsgBiz, Value: 1}, {Key: model.FieldPublishAt, Value: -1}},
+			Options: options.Index().SetName("msgBiz_publishAt"),
+		},
+		// 查询失效或待抓取的文章
+		{
+			Keys:    bson.D{{Key: model.FieldIsFail, Value: 1}, {Key: model.FieldPublishAt, Value: -1}},
+			Options: options.Index().SetName("isFail_publishAt"),
+		},
+	},
+	model.CollectionProfiles: {
+		{
+			Keys:    bson.D{{Key: model.FieldMsgBiz, Value: 1}},
+			Options: options.Index().SetName("uniq_msgBiz").SetUnique(true),
+		},
+	},
+	model.CollectionDeadLetters: {
+		{
+			Keys:    bson.D{{Key: model.FieldCreatedAt, Value: 1}},
+			Options: options.Index().SetName(model.FieldCreatedAt),
+		},
+	},
+	model.CollectionShortLinks: {
+		{
+			Keys:    bson.D{{Key: model.FieldShortID, Value: 1}},
+			Options: options.Index().SetName("uniq_shortId").SetUnique(true),
+		},
+	},
+}
+
+// EnsureIndexes 启动时创建索引, 已存在的相同索引会被跳过.
+// 集合中已有重复文档时无法创建唯一索引, 返回的错误会列出重复的键, 清理后重新启动即可
+func (r *Repository) EnsureIndexes(ctx context.Context) error {
+	var errs []error
+	for name, models := range collectionIndexes {
+		collection := r.db.Collection(name)
+		for _, index := range models {
+			if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+				errs = append(errs, indexError(ctx, collection, index, err))
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		log.Info("MongoDB索引已就绪")
+	}
+	return errors.NewAggregate(errs)
+}
+
+// indexError 说明创建索引失败的原因, 唯一索引冲突时列出部分重复的键
+func indexError(ctx context.Context, collection *driver.Collection, index driver.IndexModel, err error) error {
+	name := *index.Options.Name
+	if !driver.IsDuplicateKeyError(err) {
+		return errors.Wrapf(err, "创建索引 %s.%s 失败", collection.Name(), name)
+	}
+
+	keys := index.Keys.(bson.D)
+	group := bson.D{}
+	for _, k := range keys {
+		group = append(group, bson.E{Key: k.Key, Value: "$" + k.Key})
+	}
+	pipeline := driver.Pipeline{
+		{{Key: "$group", Value: bson.D{{Key: model.FieldID, Value: group}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+		{{Key: "$limit", Value: 10}},
+	}
+
+	var duplicates []bson.M
+	if cursor, aggErr := collection.Aggregate(ctx, pipeline); aggErr == nil {
+		_ = cursor.All(ctx, &duplicates)
+	}
+
+	var examples []string
+	for _, d := range duplicates {
+		examples = append(examples, fmt.Sprintf("%v (%v 条)", d[model.FieldID], d["count"]))
+	}
+	return errors.Errorf("集合 %s 中存在重复文档, 无法创建唯一索引 %s, 请先合并重复文档: %v", collection.Name(), name, examples)
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/mongo"
+)
+
+// MediaRepository 媒体文件
+type MediaRepository struct {
+	db *mongo.DB
+}
+
+// Create 保存新的媒体文件记录, 设置 ID 和创建时间
+func (r *MediaRepository) Create(ctx context.Context, media *model.Media) error {
+	now := time.Now()
+	media.ID = primitive.NewObjectID()
+	media.CreatedAt = now
+	media.UpdatedAt = now
+
+	_, err := r.db.Collection(model.CollectionMedia).InsertOne(ctx, media)
+	return errors.Wrap(err, "保存媒体文件失败")
+}
+
+// ListByMessageID 返回消息的全部媒体文件
+func (r *MediaRepository) ListByMessageID(ctx context.Context, messageID primitive.ObjectID) ([]*model.Media, error) {
+	var media []*model.Media
+	if err := findAll(ctx, r.db.Collection(model.CollectionMedia), bson.M{model.FieldMessageID: messageID}, &media); err != nil {
+		return nil, errors.Wrap(err, "查询媒体文件失败")
+	}
+	return media, nil
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/mongo"
+)
+
+// MessageRepository 消息
+type MessageRepository struct {
+	db *mongo.DB
+}
+
+// Create 保存新消息, 设置 ID 和创建时间
+func (r *MessageRepository) Create(ctx context.Context, message *model.Message) error {
+	now := time.Now()
+	message.ID = primitive.NewObjectID()
+	message.CreatedAt = now
+	message.UpdatedAt = now
+
+	_, err := r.db.Collection(model.CollectionMessages).InsertOne(ctx, message)
+	return errors.Wrap(err, "保存消息失败")
+}
+
+// ListByProfileID 按发送时间返回公众号的全部消息
+func (r *MessageRepository) ListByProfileID(ctx context.Context, profileID primitive.ObjectID) ([]*model.Message, error) {
+	opts := options.Find().SetSort(bson.D{{Key: model.FieldSendTime, Value: 1}})
+
+	var messages []*model.Message
+	if err := findAll(ctx, r.db.Collection(model.CollectionMessages), bson.M{model.FieldProfileID: profileID}, &messages, opts); err != nil {
+		return nil, errors.Wrap(err, "查询消息失败")
+	}
+	return messages, nil
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/mongo"
+)
+
+// SaveResult 批量保存的结果
+type SaveResult struct {
+	Inserted  int64 // 新增的文章数
+	Updated   int64 // 已存在且内容有变化的文章数
+	Unchanged int64 // 已存在且内容没有变化的文章数
+	Failed    int64 // 保存失败的文章数
+}
+
+// PostKey 文章的唯一标识
+type PostKey struct {
+	MsgBiz string
+	MsgMid string
+	MsgIdx string
+}
+
+func (k PostKey) filter() bson.M {
+	return bson.M{
+		model.FieldMsgBiz: k.MsgBiz,
+		model.FieldMsgMid: k.MsgMid,
+		model.FieldMsgIdx: k.MsgIdx,
+	}
+}
+
+// PostQuery 按公众号查询文章的条件
+type PostQuery struct {
+	MsgBiz string
+	// Failed 不为空时只返回失效(true)或有效(false)的文章
+	Failed *bool
+	// Limit 为 0 时返回全部, 按发布时间从新到旧排序
+	Limit int64
+}
+
+// PostRepository 文章, 以 msgBiz/msgMid/msgIdx 为唯一标识
+type PostRepository struct {
+	db *mongo.DB
+}
+
+func postKey(post *model.Post) PostKey {
+	return PostKey{MsgBiz: post.MsgBiz, MsgMid: post.MsgMid, MsgIdx: post.MsgIdx}
+}
+
+// SaveSummaries 一次 BulkWrite 保存整页文章概要, 单篇失败不影响其它文章.
+// 只有字段有变化时才更新 updatedAt, 以便区分更新和没有变化的文章
+func (r *PostRepository) SaveSummaries(ctx context.Context, posts []*model.Post) (SaveResult, error) {
+	if len(posts) == 0 {
+		return SaveResult{}, nil
+	}
+
+	now := time.Now()
+	models := make([]driver.WriteModel, 0, len(posts))
+	for _, post := range posts {
+		fields := setNonEmpty(bson.M{}, bson.M{
+			model.FieldTitle:         post.Title,
+			model.FieldLink:          post.Link,
+			model.FieldPublishAt:     post.PublishAt,
+			model.FieldCover:         post.Cover,
+			model.FieldDigest:        post.Digest,
+			model.FieldSourceURL:     post.SourceURL,
+			model.FieldAuthor:        post.Author,
+			model.FieldCopyrightStat: post.CopyrightStat,
+			model.FieldCapturedBy:    post.CapturedBy,
+		})
+
+		models = append(models, driver.NewUpdateOneModel().
+			SetFilter(postKey(post).filter()).
+			SetUpdate(mergePipeline(fields, now)).
+			SetUpsert(true))
+	}
+
+	opts := options.BulkWrite().SetOrdered(false)
+	res, err := r.db.Collection(model.CollectionPosts).BulkWrite(ctx, models, opts)
+
+	var result SaveResult
+	if res != nil {
+		result = SaveResult{
+			Inserted:  res.UpsertedCount,
+			Updated:   res.ModifiedCount,
+			Unchanged: res.MatchedCount - res.ModifiedCount,
+		}
+	}
+	if err != nil {
+		result.Failed, err = saveSummariesError(err, posts)
+	}
+	return result, err
+}
+
+// saveSummariesError 包装 SaveSummaries 的错误. 无序 BulkWrite 中单篇失败时列出每篇失败的文章和原因,
+// 返回失败的篇数; 不是单篇失败(如连接错误)时无法确定篇数, 返回 0
+func saveSummariesError(err error, posts []*model.Post) (int64, error) {
+	var bwe driver.BulkWriteException
+	if !errors.As(err, &bwe) || len(bwe.WriteErrors) == 0 {
+		return 0, errors.Wrap(err, "保存文章失败")
+	}
+
+	details := make([]string, 0, len(bwe.WriteErrors))
+	for _, we := range bwe.WriteErrors {
+		key := "未知文章"
+		if we.Index >= 0 && we.Index < len(posts) {
+			p := posts[we.Index]
+			key = fmt.Sprintf("%s/%s/%s", p.MsgBiz, p.MsgMid, p.MsgIdx)
+		}
+		details = append(details, fmt.Sprintf("%s: %s", key, we.Message))
+	}
+	return int64(len(details)), errors.Wrapf(err, "保存文章失败, %d 篇未保存: %s", len(details), strings.Join(details, "; "))
+}
+
+// mergePipeline 用更新管道合并字段: fields 中的值原样写入(不解析 $ 开头的字符串),
+// 任一字段与已保存的值不同时才更新 updatedAt; 插入时设置 createdAt 和 isFail
+func mergePipeline(fields bson.M, now time.Time) driver.Pipeline {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	changed := bson.A{}
+	set := bson.D{}
+	for _, k := range keys {
+		value := bson.M{"$literal": fields[k]}
+		changed = append(changed, bson.M{"$ne": bson.A{"$" + k, value}})
+		set = append(set, bson.E{Key: k, Value: value})
+	}
+
+	return driver.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: model.FieldUpdatedAt, Value: bson.M{"$cond": bson.A{bson.M{"$or": changed}, now, "$" + model.FieldUpdatedAt}}},
+			{Key: model.FieldCreatedAt, Value: bson.M{"$ifNull": bson.A{"$" + model.FieldCreatedAt, now}}},
+			{Key: model.FieldIsFail, Value: bson.M{"$ifNull": bson.A{"$" + model.FieldIsFail, false}}},
+		}}},
+		{{Key: "$set", Value: set}},
+	}
+}
+
+// SaveDetail 一次 upsert 保存文章详情: 新值为空的字段保留原值, 阅读数和点赞数只增不减.
+// 抓取到完整内容说明文章有效, 清除之前的失效标记
+func (r *PostRepository) SaveDetail(ctx context.Context, post *model.Post) error {
+	update := bson.M{
+		"$set": setNonEmpty(bson.M{model.FieldUpdatedAt: time.Now(), model.FieldIsFail: false}, bson.M{
+			model.FieldTitle:         post.Title,
+			model.FieldLink:          post.Link,
+			model.FieldRawLink:       post.RawLink,
+			model.FieldPublishAt:     post.PublishAt,
+			model.FieldCover:         post.Cover,
+			model.FieldDigest:        post.Digest,
+			model.FieldContent:       post.Content,
+			model.FieldHTML:          post.HTML,
+			model.FieldSourceURL:     post.SourceURL,
+			model.FieldAuthor:        post.Author,
+			model.FieldCopyrightStat: post.CopyrightStat,
+			model.FieldWechatID:      post.WechatId,
+			model.FieldUsername:      post.Username,
+			model.FieldCapturedBy:    post.CapturedBy,
+		}),
+		"$max": bson.M{
+			model.FieldReadNum: post.ReadNum,
+			model.FieldLikeNum: post.LikeNum,
+		},
+		"$setOnInsert": bson.M{
+			model.FieldCreatedAt: time.Now(),
+		},
+	}
+
+	return errors.Wrap(upsertOne(ctx, r.db.Collection(model.CollectionPosts), postKey(post).filter(), update), "保存文章失败")
+}
+
+// MarkInvalid 标记文章失效, 文章不存在时创建
+func (r *PostRepository) MarkInvalid(ctx context.Context, key PostKey, client string) error {
+	update := bson.M{
+		"$set": bson.M{
+			model.FieldIsFail:     true,
+			model.FieldCapturedBy: client,
+			model.FieldUpdatedAt:  time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			model.FieldCreatedAt: time.Now(),
+		},
+	}
+
+	return errors.Wrap(upsertOne(ctx, r.db.Collection(model.CollectionPosts), key.filter(), update), "更新失效文章状态失败")
+}
+
+// Find 按唯一标识查询文章
+func (r *PostRepository) Find(ctx context.Context, key PostKey) (*model.Post, error) {
+	var post model.Post
+	if err := findOne(ctx, r.db.Collection(model.CollectionPosts), key.filter(), &post); err != nil {
+		return nil, errors.Wrapf(err, "查询文章 %s/%s/%s 失败", key.MsgBiz, key.MsgMid, key.MsgIdx)
+	}
+	return &post, nil
+}
+
+// List 按发布时间从新到旧查询公众号的文章
+func (r *PostRepository) List(ctx context.Context, query PostQuery) ([]*model.Post, error) {
+	filter := bson.M{model.FieldMsgBiz: query.MsgBiz}
+	if query.Failed != nil {
+		filter[model.FieldIsFail] = *query.Failed
+	}
+	opts := options.Find().SetSort(bson.D{{Key: model.FieldPublishAt, Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(query.Limit)
+	}
+
+	var posts []*model.Post
+	if err := findAll(ctx, r.db.Collection(model.CollectionPosts), filter, &posts, opts); err != nil {
+		return nil, errors.Wrapf(err, "查询公众号 %s 的文章失败", query.MsgBiz)
+	}
+	return posts, nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/mongo"
+)
+
+// ProfileRepository 公众号资料, 以 msgBiz 为唯一标识
+type ProfileRepository struct {
+	db *mongo.DB
+}
+
+// Upsert 保存公众号资料, 新值为空的字段保留原值
+func (r *ProfileRepository) Upsert(ctx context.Context, profile *model.Profile) error {
+	filter := bson.M{model.FieldMsgBiz: profile.MsgBiz}
+	update := bson.M{
+		"$set": setNonEmpty(bson.M{model.FieldUpdatedAt: time.Now()}, bson.M{
+			model.FieldTitle:             profile.Title,
+			model.FieldHeadimg:           profile.Headimg,
+			model.FieldUsername:          profile.Username,
+			model.FieldDesc:              profile.Desc,
+			model.FieldOpenHistoryPageAt: profile.OpenHistoryPageAt,
+			model.FieldCapturedBy:        profile.CapturedBy,
+		}),
+		// 只在首次插入时设置创建时间
+		"$setOnInsert": bson.M{
+			model.FieldCreatedAt:      time.Now(),
+			model.FieldMaxDayPubCount: 0,
+		},
+	}
+
+	return errors.Wrap(upsertOne(ctx, r.db.Collection(model.CollectionProfiles), filter, update), "保存公众号资料失败")
+}
+
+// SetFirstPublishAt 设置第一篇文章的发布时间, 公众号不存在时创建
+func (r *ProfileRepository) SetFirstPublishAt(ctx context.Context, msgBiz string, firstPublishAt time.Time) error {
+	filter := bson.M{model.FieldMsgBiz: msgBiz}
+	update := bson.M{
+		"$set": bson.M{
+			model.FieldFirstPublishAt: firstPublishAt,
+			model.FieldUpdatedAt:      time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			model.FieldCreatedAt:      time.Now(),
+			model.FieldMaxDayPubCount: 0,
+		},
+	}
+
+	return errors.Wrap(upsertOne(ctx, r.db.Collection(model.CollectionProfiles), filter, update), "更新公众号最早发布时间失败")
+}
+
+// SetLatestPublishAt 设置最新发布时间, 公众号不存在时不做任何事
+func (r *ProfileRepository) SetLatestPublishAt(ctx context.Context, msgBiz string, latestPublishAt time.Time) error {
+	filter := bson.M{model.FieldMsgBiz: msgBiz}
+	update := bson.M{
+		"$set": bson.M{
+			model.FieldLatestPublishAt: latestPublishAt,
+			model.FieldUpdatedAt:       time.Now(),
+		},
+	}
+
+	_, err := r.db.Collection(model.CollectionProfiles).UpdateOne(ctx, filter, update)
+	return errors.Wrap(err, "更新公众号最新发布时间失败")
+}
+
+// FindByMsgBiz 按 msgBiz 查询公众号
+func (r *ProfileRepository) FindByMsgBiz(ctx context.Context, msgBiz string) (*model.Profile, error) {
+	var profile model.Profile
+	if err := findOne(ctx, r.db.Collection(model.CollectionProfiles), bson.M{model.FieldMsgBiz: msgBiz}, &profile); err != nil {
+		return nil, errors.Wrapf(err, "查询公众号 %s 失败", msgBiz)
+	}
+	return &profile, nil
+}
+
+// FindByUsername 按微信号(username)查询公众号
+func (r *ProfileRepository) FindByUsername(ctx context.Context, username string) (*model.Profile, error) {
+	var profile model.Profile
+	if err := findOne(ctx, r.db.Collection(model.CollectionProfiles), bson.M{model.FieldUsername: username}, &profile); err != nil {
+		return nil, errors.Wrapf(err, "查询公众号 %s 失败", username)
+	}
+	return &profile, nil
+}
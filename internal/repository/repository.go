@@ -0,0 +1,82 @@
+// Package repository 读写 MongoDB 中的公众号、文章、消息、媒体文件和死信.
+// 所有方法都接受 context, 错误原样返回调用方; 查询不到文档时返回 ErrNotFound.
+package repository
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"wechat-backup/internal/pkg/mongo"
+)
+
+// ErrNotFound 查询的文档不存在
+var ErrNotFound = errors.New("文档不存在")
+
+// Repository 各集合的访问入口
+type Repository struct {
+	db *mongo.DB
+
+	Profiles    *ProfileRepository
+	Posts       *PostRepository
+	Messages    *MessageRepository
+	Media       *MediaRepository
+	DeadLetters *DeadLetterRepository
+	ShortLinks  *ShortLinkRepository
+}
+
+// New 基于已连接的数据库创建 Repository
+func New(db *mongo.DB) *Repository {
+	return &Repository{
+		db:          db,
+		Profiles:    &ProfileRepository{db: db},
+		Posts:       &PostRepository{db: db},
+		Messages:    &MessageRepository{db: db},
+		Media:       &MediaRepository{db: db},
+		DeadLetters: &DeadLetterRepository{db: db},
+		ShortLinks:  &ShortLinkRepository{db: db},
+	}
+}
+
+// findOne 查询一条文档并解码到 result, 不存在时返回 ErrNotFound
+func findOne(ctx context.Context, collection *driver.Collection, filter interface{}, result interface{}) error {
+	err := collection.FindOne(ctx, filter).Decode(result)
+	if errors.Is(err, driver.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// findAll 查询全部匹配的文档并解码到 results
+func findAll(ctx context.Context, collection *driver.Collection, filter interface{}, results interface{}, opts ...*options.FindOptions) error {
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+// upsertOne 按 filter 更新或插入一条文档. 并发插入同一个唯一键时, 后插入的一方
+// 会遇到唯一索引冲突, 此时文档已经存在, 重试一次即变为更新
+func upsertOne(ctx context.Context, collection *driver.Collection, filter, update interface{}) error {
+	opts := options.Update().SetUpsert(true)
+	_, err := collection.UpdateOne(ctx, filter, update, opts)
+	if driver.IsDuplicateKeyError(err) {
+		_, err = collection.UpdateOne(ctx, filter, update, opts)
+	}
+	return err
+}
+
+// setNonEmpty 将 fields 中的非零值加入 set, 已保存的内容不会被空值覆盖
+func setNonEmpty(set, fields bson.M) bson.M {
+	for k, v := range fields {
+		if !reflect.ValueOf(v).IsZero() {
+			set[k] = v
+		}
+	}
+	return set
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+
+	"wechat-backup/internal/model"
+)
+
+func TestSetNonEmpty(t *testing.T) {
+	set := setNonEmpty(bson.M{model.FieldUpdatedAt: "now"}, bson.M{
+		model.FieldTitle:         "标题",
+		model.FieldDigest:        "",
+		model.FieldPublishAt:     time.Time{},
+		model.FieldCopyrightStat: 0,
+		model.FieldCover:         "cover.jpg",
+	})
+
+	assert.Equal(t, bson.M{model.FieldUpdatedAt: "now", model.FieldTitle: "标题", model.FieldCover: "cover.jpg"}, set)
+}
+
+func TestMergePipeline(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	pipeline := mergePipeline(bson.M{model.FieldTitle: "$不是字段", model.FieldLink: "link"}, now)
+
+	// 字段按名称排序, 值不会被当作字段引用
+	assert.Len(t, pipeline, 2)
+	assert.Equal(t, bson.D{
+		{Key: model.FieldLink, Value: bson.M{"$literal": "link"}},
+		{Key: model.FieldTitle, Value: bson.M{"$literal": "$不是字段"}},
+	}, pipeline[1][0].Value)
+
+	updatedAt := pipeline[0][0].Value.(bson.D)[0]
+	assert.Equal(t, model.FieldUpdatedAt, updatedAt.Key)
+	cond := updatedAt.Value.(bson.M)["$cond"].(bson.A)
+	assert.Len(t, cond[0].(bson.M)["$or"], 2)
+	assert.Equal(t, now, cond[1])
+}
+
+func TestPostKeyFilter(t *testing.T) {
+	key := PostKey{MsgBiz: "biz", MsgMid: "1", MsgIdx: "2"}
+	assert.Equal(t, bson.M{model.FieldMsgBiz: "biz", model.FieldMsgMid: "1", model.FieldMsgIdx: "2"}, key.filter())
+}
+
+func TestSaveSummariesError(t *testing.T) {
+	posts := []*model.Post{
+		{MsgBiz: "biz", MsgMid: "1", MsgIdx: "1"},
+		{MsgBiz: "biz", MsgMid: "2", MsgIdx: "1"},
+		{MsgBiz: "biz", MsgMid: "3", MsgIdx: "1"},
+	}
+
+	// 单篇失败时列出失败的文章
+	bwe := driver.BulkWriteException{WriteErrors: []driver.BulkWriteError{
+		{WriteError: driver.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}},
+		{WriteError: driver.WriteError{Index: 2, Code: 2, Message: "bad value"}},
+	}}
+	failed, err := saveSummariesError(bwe, posts)
+	assert.Equal(t, int64(2), failed)
+	assert.ErrorContains(t, err, "2 篇未保存")
+	assert.ErrorContains(t, err, "biz/1/1: duplicate key")
+	assert.ErrorContains(t, err, "biz/3/1: bad value")
+	assert.NotContains(t, err.Error(), "biz/2/1")
+
+	failed, err = saveSummariesError(driver.ErrClientDisconnected, posts)
+	assert.Zero(t, failed)
+	assert.ErrorContains(t, err, "保存文章失败")
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/marmotedu/errors"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"wechat-backup/internal/model"
+	"wechat-backup/internal/pkg/mongo"
+)
+
+// ShortLinkRepository 短链接到文章唯一标识的映射, 以短链接 ID 为唯一标识
+type ShortLinkRepository struct {
+	db *mongo.DB
+}
+
+// Upsert 保存短链接对应的文章
+func (r *ShortLinkRepository) Upsert(ctx context.Context, link *model.ShortLink) error {
+	filter := bson.M{model.FieldShortID: link.ShortID}
+	update := bson.M{
+		"$set": bson.M{
+			model.FieldMsgBiz:    link.MsgBiz,
+			model.FieldMsgMid:    link.MsgMid,
+			model.FieldMsgIdx:    link.MsgIdx,
+			model.FieldUpdatedAt: time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			model.FieldCreatedAt: time.Now(),
+		},
+	}
+
+	return errors.Wrap(upsertOne(ctx, r.db.Collection(model.CollectionShortLinks), filter, update), "保存短链接失败")
+}
+
+// FindByShortID 按短链接 ID 查询对应的文章
+func (r *ShortLinkRepository) FindByShortID(ctx context.Context, shortID string) (*model.ShortLink, error) {
+	var link model.ShortLink
+	if err := findOne(ctx, r.db.Collection(model.CollectionShortLinks), bson.M{model.FieldShortID: shortID}, &link); err != nil {
+		return nil, errors.Wrapf(err, "查询短链接 %s 失败", shortID)
+	}
+	return &link, nil
+}